@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	attrTargetGroupArn string = "target_group_arn"
+	// statusDescriptionHeader lets the worker override the ALB status description, the header is not sent to the client
+	statusDescriptionHeader string = "X-Status-Description"
+)
+
+// albHandler handles the Application Load Balancer target group events
+func (p *Plugin) albHandler() func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	return func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response := p.serveALB(ctx, &request)
+		p.albResponseHeaders(&request, &response)
+
+		return response, nil
+	}
+}
+
+// serveALB returns the error or the prepared worker response
+func (p *Plugin) serveALB(ctx context.Context, request *events.ALBTargetGroupRequest) events.ALBTargetGroupResponse {
+	if !p.acquire() {
+		return albErrorResponse(http.StatusServiceUnavailable)
+	}
+	defer p.release()
+
+	attrs := p.getAttrs()
+	defer p.putAttrs(attrs)
+	attrs[attrRequestID] = requestID(ctx)
+	attrs[attrTargetGroupArn] = request.RequestContext.ELB.TargetGroupArn
+
+	var response events.ALBTargetGroupResponse
+	err := p.invoke(ctx, p.selectPool(request.Path), request, attrs, &response)
+	if err != nil {
+		if errors.Is(errors.NoFreeWorkers, err) || errors.Is(errors.QueueSize, err) {
+			return albErrorResponse(http.StatusServiceUnavailable)
+		}
+
+		return albErrorResponse(http.StatusInternalServerError)
+	}
+
+	response.StatusCode = p.workerStatus(ctx, response.StatusCode)
+	response.StatusDescription = albStatusDescription(&response)
+	p.albHeaders(ctx, request, &response)
+	p.albBody(&response)
+
+	return response
+}
+
+// albResponseHeaders adds the configured response headers to the response field matching the target group mode
+// (see albHeaders), the error responses included
+func (p *Plugin) albResponseHeaders(request *events.ALBTargetGroupRequest, response *events.ALBTargetGroupResponse) {
+	if len(p.cfg.ResponseHeaders) == 0 {
+		return
+	}
+
+	multi := len(request.MultiValueHeaders) > 0
+	if multi && response.MultiValueHeaders == nil {
+		response.MultiValueHeaders = make(map[string][]string, len(p.cfg.ResponseHeaders))
+	}
+	if !multi && response.Headers == nil {
+		response.Headers = make(map[string]string, len(p.cfg.ResponseHeaders))
+	}
+
+	// albHeaders canonicalizes the worker header names
+	for k, v := range p.cfg.ResponseHeaders {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		if multi {
+			if _, ok := response.MultiValueHeaders[ck]; !ok || p.cfg.ResponseHeadersOverride {
+				response.MultiValueHeaders[ck] = []string{v}
+			}
+			continue
+		}
+
+		if _, ok := response.Headers[ck]; !ok || p.cfg.ResponseHeadersOverride {
+			response.Headers[ck] = v
+		}
+	}
+}
+
+// albHeaders puts the worker headers into the response field matching the target group mode. With the multi-value
+// headers enabled (the request has MultiValueHeaders) ALB only reads MultiValueHeaders, otherwise only Headers,
+// where the repeated values are comma-joined and only the first Set-Cookie can be sent
+func (p *Plugin) albHeaders(ctx context.Context, request *events.ALBTargetGroupRequest, response *events.ALBTargetGroupResponse) {
+	headers := mergeHeaders(response.Headers, response.MultiValueHeaders)
+
+	if len(request.MultiValueHeaders) > 0 {
+		response.Headers = nil
+		response.MultiValueHeaders = headers
+		return
+	}
+
+	response.MultiValueHeaders = nil
+	response.Headers = make(map[string]string, len(headers))
+	for k, v := range headers {
+		if k == "Set-Cookie" && len(v) > 1 {
+			p.log.Warn("multi-value headers are disabled for the target group, only the first cookie is sent",
+				zap.String("request_id", requestID(ctx)),
+				zap.Int("cookies", len(v)),
+			)
+			v = v[:1]
+		}
+
+		response.Headers[k] = strings.Join(v, ", ")
+	}
+}
+
+// albBody base64 encodes the binary (binary_media_types or compressed by the worker) response bodies.
+// The bodies the worker sent base64 encoded are kept as is, ALB decodes them whatever the content type
+func (p *Plugin) albBody(response *events.ALBTargetGroupResponse) {
+	if response.Body == "" || response.IsBase64Encoded {
+		return
+	}
+
+	ct := albHeader(response, "content-type")
+	if p.cfg.BinarySafe || p.isBinary(ct) || contentEncoded(albHeader(response, "content-encoding")) {
+		response.Body = base64.StdEncoding.EncodeToString([]byte(response.Body))
+		response.IsBase64Encoded = true
+	}
+}
+
+// albHeader returns the first value of the response header, albHeaders should be called first
+func albHeader(response *events.ALBTargetGroupResponse, name string) string {
+	if v := getHeader(response.Headers, name); v != "" {
+		return v
+	}
+
+	for k, v := range response.MultiValueHeaders {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+// albStatusDescription returns the status description for the response: the worker override header,
+// the worker provided description or the standard reason phrase (404 -> "404 Not Found")
+func albStatusDescription(response *events.ALBTargetGroupResponse) string {
+	description := getHeader(response.Headers, statusDescriptionHeader)
+	delHeader(response.Headers, statusDescriptionHeader)
+
+	for k, v := range response.MultiValueHeaders {
+		if strings.EqualFold(k, statusDescriptionHeader) {
+			if description == "" && len(v) > 0 {
+				description = v[0]
+			}
+			delete(response.MultiValueHeaders, k)
+		}
+	}
+
+	if description == "" {
+		description = response.StatusDescription
+	}
+
+	code := strconv.Itoa(response.StatusCode)
+	switch {
+	case description == "":
+		text := http.StatusText(response.StatusCode)
+		if text == "" {
+			text = "Unknown"
+		}
+
+		return code + " " + text
+	case strings.HasPrefix(description, code+" "):
+		return description
+	default:
+		// reason phrase only
+		return code + " " + description
+	}
+}
+
+func albErrorResponse(status int) events.ALBTargetGroupResponse {
+	return events.ALBTargetGroupResponse{
+		StatusCode:        status,
+		StatusDescription: strconv.Itoa(status) + " " + http.StatusText(status),
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestALBStatusDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		response events.ALBTargetGroupResponse
+		want     string
+	}{
+		{name: "ok", response: events.ALBTargetGroupResponse{StatusCode: 200}, want: "200 OK"},
+		{name: "not found", response: events.ALBTargetGroupResponse{StatusCode: 404}, want: "404 Not Found"},
+		{name: "teapot", response: events.ALBTargetGroupResponse{StatusCode: 418}, want: "418 I'm a teapot"},
+		{name: "non-standard", response: events.ALBTargetGroupResponse{StatusCode: 599}, want: "599 Unknown"},
+		{name: "worker description", response: events.ALBTargetGroupResponse{StatusCode: 404, StatusDescription: "404 Missing"}, want: "404 Missing"},
+		{name: "worker reason phrase", response: events.ALBTargetGroupResponse{StatusCode: 499, StatusDescription: "Client Closed Request"}, want: "499 Client Closed Request"},
+		{
+			name: "header override",
+			response: events.ALBTargetGroupResponse{
+				StatusCode:        422,
+				StatusDescription: "422 Ignored",
+				Headers:           map[string]string{"x-status-description": "Invalid Order"},
+			},
+			want: "422 Invalid Order",
+		},
+		{
+			name: "multi-value header override",
+			response: events.ALBTargetGroupResponse{
+				StatusCode:        299,
+				MultiValueHeaders: map[string][]string{"X-Status-Description": {"Partial"}},
+			},
+			want: "299 Partial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, albStatusDescription(&tt.response))
+			assert.Empty(t, getHeader(tt.response.Headers, statusDescriptionHeader))
+			assert.Empty(t, tt.response.MultiValueHeaders)
+		})
+	}
+}
+
+func TestALBStatusDescriptionHeaderNotSent(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeALB}, respond(events.ALBTargetGroupResponse{
+		StatusCode: http.StatusConflict,
+		Headers:    map[string]string{"Content-Type": "text/plain", statusDescriptionHeader: "Already Exists"},
+		Body:       "exists",
+	}, nil))
+
+	rsp, err := p.albHandler()(testContext(), events.ALBTargetGroupRequest{HTTPMethod: http.MethodPost, Path: "/users"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rsp.StatusCode)
+	assert.Equal(t, "409 Already Exists", rsp.StatusDescription)
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain"}, rsp.Headers)
+}
+
+func TestALBErrorResponse(t *testing.T) {
+	assert.Equal(t, events.ALBTargetGroupResponse{StatusCode: 503, StatusDescription: "503 Service Unavailable"}, albErrorResponse(http.StatusServiceUnavailable))
+}
+
+func TestALBMultiValueHeaders(t *testing.T) {
+	worker := events.ALBTargetGroupResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"content-type": "text/plain", "Set-Cookie": "a=1\nb=2"},
+		Body:       "ok",
+	}
+
+	// the target group with the multi-value headers enabled sends the MultiValueHeaders
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeALB}, respond(worker, nil))
+
+	rsp, err := p.albHandler()(testContext(), events.ALBTargetGroupRequest{
+		HTTPMethod:        http.MethodGet,
+		Path:              "/",
+		MultiValueHeaders: map[string][]string{"host": {"example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, rsp.Headers)
+	assert.Equal(t, map[string][]string{"Content-Type": {"text/plain"}, "Set-Cookie": {"a=1", "b=2"}}, rsp.MultiValueHeaders)
+
+	// only the first cookie can be sent otherwise
+	p = &Plugin{}
+	logs := newTestPlugin(t, p, &Config{EventType: eventTypeALB}, respond(worker, nil))
+
+	rsp, err = p.albHandler()(testContext(), events.ALBTargetGroupRequest{
+		HTTPMethod: http.MethodGet,
+		Path:       "/",
+		Headers:    map[string]string{"host": "example.com"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, rsp.MultiValueHeaders)
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain", "Set-Cookie": "a=1"}, rsp.Headers)
+	assert.Equal(t, 1, logs.FilterMessage("multi-value headers are disabled for the target group, only the first cookie is sent").Len())
+}
+
+func TestALBBinaryResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		binaryTypes []string
+		response    events.ALBTargetGroupResponse
+		wantBody    string
+		wantBase64  bool
+	}{
+		{
+			name:        "binary media type",
+			binaryTypes: []string{"image/*"},
+			response:    events.ALBTargetGroupResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "image/png"}, Body: "png"},
+			wantBody:    base64.StdEncoding.EncodeToString([]byte("png")),
+			wantBase64:  true,
+		},
+		{
+			name:       "compressed by the worker",
+			response:   events.ALBTargetGroupResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "text/plain", "Content-Encoding": "gzip"}, Body: "gz"},
+			wantBody:   base64.StdEncoding.EncodeToString([]byte("gz")),
+			wantBase64: true,
+		},
+		{
+			name:        "already encoded binary",
+			binaryTypes: []string{"image/*"},
+			response:    events.ALBTargetGroupResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "image/png"}, Body: "cG5n", IsBase64Encoded: true},
+			wantBody:    "cG5n",
+			wantBase64:  true,
+		},
+		{
+			name:        "text",
+			binaryTypes: []string{"image/*"},
+			response:    events.ALBTargetGroupResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"id":1}`},
+			wantBody:    `{"id":1}`,
+		},
+		{
+			name:        "text encoded by the worker",
+			binaryTypes: []string{"image/*"},
+			response: events.ALBTargetGroupResponse{
+				StatusCode:      200,
+				Headers:         map[string]string{"Content-Type": "text/html"},
+				Body:            base64.StdEncoding.EncodeToString([]byte("<p>hi</p>")),
+				IsBase64Encoded: true,
+			},
+			wantBody:   base64.StdEncoding.EncodeToString([]byte("<p>hi</p>")),
+			wantBase64: true,
+		},
+		{
+			// not in the binary media types, decoding would corrupt it
+			name:        "binary encoded by the worker",
+			binaryTypes: []string{"image/*"},
+			response: events.ALBTargetGroupResponse{
+				StatusCode:      200,
+				Headers:         map[string]string{"Content-Type": "application/pdf"},
+				Body:            base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\xff\xfe")),
+				IsBase64Encoded: true,
+			},
+			wantBody:   base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\xff\xfe")),
+			wantBase64: true,
+		},
+		{
+			name:       "text encoded by the worker without binary media types",
+			response:   events.ALBTargetGroupResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "text/html"}, Body: "PHA+aGk8L3A+", IsBase64Encoded: true},
+			wantBody:   "PHA+aGk8L3A+",
+			wantBase64: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{EventType: eventTypeALB, BinaryMediaTypes: tt.binaryTypes}, respond(tt.response, nil))
+
+			rsp, err := p.albHandler()(testContext(), events.ALBTargetGroupRequest{HTTPMethod: http.MethodGet, Path: "/file"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, rsp.Body)
+			assert.Equal(t, tt.wantBase64, rsp.IsBase64Encoded)
+		})
+	}
+}
+
+func TestALBConfiguredResponseHeaders(t *testing.T) {
+	cfgHeaders := map[string]string{"x-content-type-options": "nosniff", "cache-control": "no-store"}
+
+	tests := []struct {
+		name     string
+		override bool
+		multi    bool
+		busy     bool
+		want     map[string]string
+	}{
+		{name: "worker value kept", want: map[string]string{"Content-Type": "text/plain", "Cache-Control": "max-age=60", "X-Content-Type-Options": "nosniff"}},
+		{name: "override", override: true, want: map[string]string{"Content-Type": "text/plain", "Cache-Control": "no-store", "X-Content-Type-Options": "nosniff"}},
+		{name: "multi-value headers", multi: true, want: map[string]string{"Content-Type": "text/plain", "Cache-Control": "max-age=60", "X-Content-Type-Options": "nosniff"}},
+		{name: "error response", busy: true, want: map[string]string{"Cache-Control": "no-store", "X-Content-Type-Options": "nosniff"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			cfg := &Config{EventType: eventTypeALB, ResponseHeaders: cfgHeaders, ResponseHeadersOverride: tt.override}
+			if tt.busy {
+				cfg.MaxConcurrency = 1
+			}
+
+			newTestPlugin(t, p, cfg, respond(events.ALBTargetGroupResponse{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"content-type": "text/plain", "cache-control": "max-age=60"},
+				Body:       "ok",
+			}, nil))
+
+			if tt.busy {
+				require.True(t, p.acquire())
+				defer p.release()
+			}
+
+			request := events.ALBTargetGroupRequest{HTTPMethod: http.MethodGet, Path: "/"}
+			if tt.multi {
+				request.MultiValueHeaders = map[string][]string{"host": {"example.com"}}
+			}
+
+			rsp, err := p.albHandler()(testContext(), request)
+			require.NoError(t, err)
+
+			if !tt.multi {
+				assert.Nil(t, rsp.MultiValueHeaders)
+				assert.Equal(t, tt.want, rsp.Headers)
+				return
+			}
+
+			assert.Nil(t, rsp.Headers)
+			want := make(map[string][]string, len(tt.want))
+			for k, v := range tt.want {
+				want[k] = []string{v}
+			}
+			assert.Equal(t, want, rsp.MultiValueHeaders)
+		})
+	}
+}
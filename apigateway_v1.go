@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// payloadFormat discriminates the API Gateway events: the HTTP API sends the version (1.0 or 2.0),
+// the REST API sends the 1.0 format without the version
+type payloadFormat struct {
+	Version    string `json:"version"`
+	HTTPMethod string `json:"httpMethod"`
+}
+
+func (f *payloadFormat) v1() bool {
+	return f.Version == "1.0" || (f.Version == "" && f.HTTPMethod != "")
+}
+
+// v2Request converts the payload format 1.0 request into the 2.0 one. The repeated headers and query
+// parameters are comma-joined (as API Gateway does for 2.0), the Cookie header is moved to the cookies
+func v2Request(r *events.APIGatewayProxyRequest) events.APIGatewayV2HTTPRequest {
+	request := events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              r.HTTPMethod + " " + r.Resource,
+		RawPath:               r.Path,
+		Headers:               make(map[string]string, len(r.Headers)),
+		QueryStringParameters: r.QueryStringParameters,
+		PathParameters:        r.PathParameters,
+		StageVariables:        r.StageVariables,
+		Body:                  r.Body,
+		IsBase64Encoded:       r.IsBase64Encoded,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:     r.HTTPMethod + " " + r.Resource,
+			AccountID:    r.RequestContext.AccountID,
+			Stage:        r.RequestContext.Stage,
+			RequestID:    r.RequestContext.RequestID,
+			APIID:        r.RequestContext.APIID,
+			DomainName:   r.RequestContext.DomainName,
+			DomainPrefix: r.RequestContext.DomainPrefix,
+			Time:         r.RequestContext.RequestTime,
+			TimeEpoch:    r.RequestContext.RequestTimeEpoch,
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.HTTPMethod,
+				Path:      r.Path,
+				Protocol:  r.RequestContext.Protocol,
+				SourceIP:  r.RequestContext.Identity.SourceIP,
+				UserAgent: r.RequestContext.Identity.UserAgent,
+			},
+		},
+	}
+
+	if len(r.RequestContext.Authorizer) > 0 {
+		request.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			Lambda: r.RequestContext.Authorizer,
+		}
+	}
+
+	for k, v := range mergeHeaders(r.Headers, r.MultiValueHeaders) {
+		if k == "Cookie" {
+			for i := 0; i < len(v); i++ {
+				for _, c := range strings.Split(v[i], ";") {
+					if c = strings.TrimSpace(c); c != "" {
+						request.Cookies = append(request.Cookies, c)
+					}
+				}
+			}
+
+			continue
+		}
+
+		request.Headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+
+	if len(r.MultiValueQueryStringParameters) > 0 {
+		request.RawQueryString = url.Values(r.MultiValueQueryStringParameters).Encode()
+		request.QueryStringParameters = make(map[string]string, len(r.MultiValueQueryStringParameters))
+		for k, v := range r.MultiValueQueryStringParameters {
+			request.QueryStringParameters[k] = strings.Join(v, ",")
+		}
+	}
+
+	return request
+}
+
+// v1Response converts the payload format 2.0 response into the 1.0 one,
+// the repeated headers and the cookies are sent in the MultiValueHeaders
+func v1Response(r *events.APIGatewayV2HTTPResponse) events.APIGatewayProxyResponse {
+	response := events.APIGatewayProxyResponse{
+		StatusCode:      r.StatusCode,
+		Body:            r.Body,
+		IsBase64Encoded: r.IsBase64Encoded,
+	}
+
+	headers := mergeHeaders(r.Headers, map[string][]string{"Set-Cookie": r.Cookies})
+	for k, v := range headers {
+		if len(v) == 1 {
+			if response.Headers == nil {
+				response.Headers = make(map[string]string, len(headers))
+			}
+
+			response.Headers[k] = v[0]
+			continue
+		}
+
+		if response.MultiValueHeaders == nil {
+			response.MultiValueHeaders = make(map[string][]string, 1)
+		}
+
+		response.MultiValueHeaders[k] = v
+	}
+
+	return response
+}
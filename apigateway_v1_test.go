@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkV2Request(b *testing.B) {
+	request := &events.APIGatewayProxyRequest{
+		Resource:                        "/users/{id}",
+		Path:                            "/users/1",
+		HTTPMethod:                      "GET",
+		Headers:                         map[string]string{"Accept": "application/json", "Cookie": "a=1; b=2"},
+		MultiValueHeaders:               map[string][]string{"Accept": {"application/json"}, "Cookie": {"a=1; b=2"}},
+		MultiValueQueryStringParameters: map[string][]string{"tag": {"a", "b"}},
+		PathParameters:                  map[string]string{"id": "1"},
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = v2Request(request)
+	}
+}
+
+func TestV1ResponseMultiValueHeaders(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "text/plain", "Set-Cookie": "sid=abc; HttpOnly\nlang=en; Path=/"},
+		Body:       "ok",
+	}, nil))
+
+	event, err := json.Marshal(events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/login", Resource: "/login"})
+	require.NoError(t, err)
+
+	out, err := p.handler()(testContext(), event)
+	require.NoError(t, err)
+
+	rsp, ok := out.(events.APIGatewayProxyResponse)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain"}, rsp.Headers)
+	assert.Equal(t, map[string][]string{"Set-Cookie": {"sid=abc; HttpOnly", "lang=en; Path=/"}}, rsp.MultiValueHeaders)
+}
+
+func TestPayloadFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		want  bool
+	}{
+		{name: "http api 2.0", event: `{"version":"2.0","rawPath":"/users"}`, want: false},
+		{name: "http api 1.0", event: `{"version":"1.0","httpMethod":"GET","path":"/users"}`, want: true},
+		{name: "rest api", event: `{"httpMethod":"GET","path":"/users"}`, want: true},
+		{name: "no discriminator", event: `{"rawPath":"/users"}`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var format payloadFormat
+			require.NoError(t, json.Unmarshal([]byte(tt.event), &format))
+			assert.Equal(t, tt.want, format.v1())
+		})
+	}
+}
+
+func TestV2Request(t *testing.T) {
+	request := v2Request(&events.APIGatewayProxyRequest{
+		Resource:                        "/users/{id}",
+		Path:                            "/users/1",
+		HTTPMethod:                      "POST",
+		Headers:                         map[string]string{"Content-Type": "application/json", "Cookie": "a=1; b=2"},
+		MultiValueHeaders:               map[string][]string{"Accept": {"text/html", "application/json"}},
+		MultiValueQueryStringParameters: map[string][]string{"tag": {"a", "b"}},
+		PathParameters:                  map[string]string{"id": "1"},
+		Body:                            `{"name":"test"}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Stage:      "prod",
+			DomainName: "api.example.com",
+			Identity:   events.APIGatewayRequestIdentity{SourceIP: "203.0.113.7"},
+		},
+	})
+
+	assert.Equal(t, "2.0", request.Version)
+	assert.Equal(t, "POST /users/{id}", request.RouteKey)
+	assert.Equal(t, "/users/1", request.RawPath)
+	assert.Equal(t, "POST", request.RequestContext.HTTP.Method)
+	assert.Equal(t, "203.0.113.7", request.RequestContext.HTTP.SourceIP)
+	assert.Equal(t, "prod", request.RequestContext.Stage)
+	assert.Equal(t, map[string]string{"content-type": "application/json", "accept": "text/html,application/json"}, request.Headers)
+	assert.Equal(t, []string{"a=1", "b=2"}, request.Cookies)
+	assert.Equal(t, "tag=a&tag=b", request.RawQueryString)
+	assert.Equal(t, map[string]string{"tag": "a,b"}, request.QueryStringParameters)
+	assert.Equal(t, map[string]string{"id": "1"}, request.PathParameters)
+	assert.Equal(t, `{"name":"test"}`, request.Body)
+}
+
+func TestHandlerPayloadFormats(t *testing.T) {
+	v2, err := json.Marshal(testRequest("/users"))
+	require.NoError(t, err)
+
+	v1, err := json.Marshal(map[string]any{"version": "1.0", "httpMethod": "GET", "path": "/users", "resource": "/users"})
+	require.NoError(t, err)
+
+	rest, err := json.Marshal(events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/users", Resource: "/users"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		event []byte
+		want  any
+	}{
+		{name: "http api 2.0", event: v2, want: events.APIGatewayV2HTTPResponse{}},
+		{name: "http api 1.0", event: v1, want: events.APIGatewayProxyResponse{}},
+		{name: "rest api", event: rest, want: events.APIGatewayProxyResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 201, Body: "created"}, &requests))
+
+			out, err := p.handler()(testContext(), tt.event)
+			require.NoError(t, err)
+			assert.IsType(t, tt.want, out)
+
+			// the worker always gets the 2.0 request
+			require.Len(t, requests, 1)
+			assert.Equal(t, "2.0", requests[0].Version)
+			assert.Equal(t, "/users", requests[0].RawPath)
+			assert.Equal(t, "GET", requests[0].RequestContext.HTTP.Method)
+		})
+	}
+}
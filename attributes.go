@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// attributes sent to the worker in the payload context
+const (
+	attrRequestID string = "request_id"
+	attrAccountID string = "account_id"
+	attrAPIID     string = "api_id"
+	attrStage     string = "stage"
+	attrTime      string = "time"
+	attrTimeEpoch string = "time_epoch"
+	attrRawEvent  string = "lambda_raw_event"
+	// prefix of the route template path parameters (/users/{id} -> path_param_id)
+	attrPathParamPrefix string = "path_param_"
+)
+
+// fillAttributes copies the invocation and API Gateway request context scalars and the path parameters into the attributes
+func fillAttributes(ctx context.Context, request *events.APIGatewayV2HTTPRequest, attrs map[string]string) {
+	attrs[attrRequestID] = requestID(ctx)
+	attrs[attrAccountID] = request.RequestContext.AccountID
+	attrs[attrAPIID] = request.RequestContext.APIID
+	attrs[attrStage] = request.RequestContext.Stage
+	attrs[attrTime] = request.RequestContext.Time
+	attrs[attrTimeEpoch] = strconv.FormatInt(request.RequestContext.TimeEpoch, 10)
+
+	for k, v := range request.PathParameters {
+		attrs[attrPathParamPrefix+k] = v
+	}
+}
+
+// setRawEvent adds the JSON of the original event to the attributes, truncated to the raw_event_max_size
+func (p *Plugin) setRawEvent(ctx context.Context, event any, attrs map[string]string) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		p.log.Debug("failed to encode the raw event", zap.String("request_id", requestID(ctx)), zap.Error(err))
+		return
+	}
+
+	if len(data) > p.cfg.RawEventMaxSize {
+		data = data[:p.cfg.RawEventMaxSize]
+	}
+
+	attrs[attrRawEvent] = string(data)
+}
+
+func (p *Plugin) putAttrs(attrs map[string]string) {
+	clear(attrs)
+	p.attrPool.Put(attrs)
+}
+
+func (p *Plugin) getAttrs() map[string]string {
+	return p.attrPool.Get().(map[string]string)
+}
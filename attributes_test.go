@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureAttrs returns the exec handler storing the payload context attributes sent to the worker
+func captureAttrs(attrs *[]map[string]string) execFunc {
+	return func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		var a map[string]string
+		err := json.Unmarshal(pld.Context, &a)
+		if err != nil {
+			return nil, err
+		}
+
+		*attrs = append(*attrs, a)
+		return &payload.Payload{Body: []byte(`{"statusCode":200}`)}, nil
+	}
+}
+
+func TestRequestContextAttributes(t *testing.T) {
+	var attrs []map[string]string
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, captureAttrs(&attrs))
+
+	request := testRequest("/users")
+	request.RequestContext.AccountID = "123456789012"
+	request.RequestContext.APIID = "abc123"
+	request.RequestContext.Stage = "prod"
+	request.RequestContext.Time = "12/Mar/2020:19:03:58 +0000"
+	request.RequestContext.TimeEpoch = 1583348638390
+
+	serve(t, p, request)
+	require.Len(t, attrs, 1)
+	assert.Equal(t, testRequestID, attrs[0][attrRequestID])
+	assert.Equal(t, "123456789012", attrs[0][attrAccountID])
+	assert.Equal(t, "abc123", attrs[0][attrAPIID])
+	assert.Equal(t, "prod", attrs[0][attrStage])
+	assert.Equal(t, "12/Mar/2020:19:03:58 +0000", attrs[0][attrTime])
+	assert.Equal(t, "1583348638390", attrs[0][attrTimeEpoch])
+
+	// the pooled attributes don't leak into the next request
+	serve(t, p, testRequest("/users"))
+	require.Len(t, attrs, 2)
+	assert.Empty(t, attrs[1][attrAccountID])
+	assert.Equal(t, "0", attrs[1][attrTimeEpoch])
+}
+
+func TestPassRawEvent(t *testing.T) {
+	request := testRequest("/users")
+	request.Body = `{"name":"test"}`
+
+	event, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		want    string
+		present bool
+	}{
+		{name: "enabled", cfg: &Config{PassRawEvent: true}, want: string(event), present: true},
+		{name: "truncated", cfg: &Config{PassRawEvent: true, RawEventMaxSize: 20}, want: string(event[:20]), present: true},
+		{name: "disabled", cfg: &Config{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attrs []map[string]string
+			p := &Plugin{}
+			newTestPlugin(t, p, tt.cfg, captureAttrs(&attrs))
+
+			serve(t, p, request)
+			require.Len(t, attrs, 1)
+
+			raw, ok := attrs[0][attrRawEvent]
+			assert.Equal(t, tt.present, ok)
+			assert.Equal(t, tt.want, raw)
+		})
+	}
+}
+
+func TestPathParameterAttributes(t *testing.T) {
+	var attrs []map[string]string
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, captureAttrs(&attrs))
+
+	request := testRequest("/users/42/posts/7")
+	request.RouteKey = "GET /users/{id}/posts/{post}"
+	request.PathParameters = map[string]string{"id": "42", "post": "7"}
+
+	serve(t, p, request)
+	require.Len(t, attrs, 1)
+	assert.Equal(t, "42", attrs[0]["path_param_id"])
+	assert.Equal(t, "7", attrs[0]["path_param_post"])
+
+	// the pooled attributes don't keep the previous request parameters
+	request = testRequest("/users/1")
+	request.PathParameters = map[string]string{"id": "1"}
+
+	serve(t, p, request)
+	require.Len(t, attrs, 2)
+	assert.Equal(t, "1", attrs[1]["path_param_id"])
+	assert.NotContains(t, attrs[1], "path_param_post")
+}
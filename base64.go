@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/base64"
+)
+
+// decodeBase64 decodes the standard or URL-safe base64, padded or not. Empty input is an empty body
+func decodeBase64(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err == nil {
+		return data, nil
+	}
+
+	for _, enc := range []*base64.Encoding{base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		data, errD := enc.DecodeString(s)
+		if errD == nil {
+			return data, nil
+		}
+	}
+
+	// the standard encoding error is the most relevant one
+	return nil, err
+}
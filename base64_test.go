@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBase64(t *testing.T) {
+	// 0xfb 0xff encodes to the alphabet specific characters
+	binary := []byte{0xfb, 0xff, 0xbf, 0x01}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []byte
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "standard", input: "+/+/AQ==", want: binary},
+		{name: "standard unpadded", input: "+/+/AQ", want: binary},
+		{name: "url-safe", input: "-_-_AQ==", want: binary},
+		{name: "url-safe unpadded", input: "-_-_AQ", want: binary},
+		{name: "text", input: "aGVsbG8=", want: []byte("hello")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := decodeBase64(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, data)
+		})
+	}
+
+	for _, input := range []string{"%%%", "a", "+/-_"} {
+		_, err := decodeBase64(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestEmptyBase64Body(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{ValidateJSON: true, BinaryMediaTypes: []string{"image/*"}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+	request := testRequest("/users")
+	request.Headers["content-type"] = "application/json"
+	request.IsBase64Encoded = true
+
+	rsp := serve(t, p, request)
+	assert.Equal(t, 200, rsp.StatusCode)
+	require.Len(t, requests, 1)
+	assert.Empty(t, requests[0].Body)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	attrOwner       string = "owner"
+	attrLogGroup    string = "log_group"
+	attrLogStream   string = "log_stream"
+	attrMessageType string = "message_type"
+)
+
+// cloudwatchLogsHandler handles the CloudWatch Logs subscription events. The base64 gzipped data is decoded
+// and the resulting logs data (with the logEvents) is sent to the worker. Errors are returned to make lambda retry
+func (p *Plugin) cloudwatchLogsHandler() func(ctx context.Context, event events.CloudwatchLogsEvent) error {
+	return func(ctx context.Context, event events.CloudwatchLogsEvent) error {
+		const op = errors.Op("lambda_cloudwatch_logs_handler")
+
+		data, err := p.parseLogs(&event)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		if !p.acquire() {
+			return errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+		attrs[attrRequestID] = requestID(ctx)
+		attrs[attrOwner] = data.Owner
+		attrs[attrLogGroup] = data.LogGroup
+		attrs[attrLogStream] = data.LogStream
+		attrs[attrMessageType] = data.MessageType
+
+		err = p.invoke(ctx, p.wrkPool, data, attrs, nil)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		return nil
+	}
+}
+
+// parseLogs decodes the base64 gzipped logs data, the decoded size is limited by the max_body_size
+func (p *Plugin) parseLogs(event *events.CloudwatchLogsEvent) (*events.CloudwatchLogsData, error) {
+	raw, err := decodeBase64(event.AWSLogs.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = decodeBody(encodingGzip, raw, p.cfg.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &events.CloudwatchLogsData{}
+	err = json.Unmarshal(raw, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
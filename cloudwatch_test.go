@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logsEvent builds the subscription event with the base64 gzipped logs data
+func logsEvent(t testing.TB, data *events.CloudwatchLogsData) events.CloudwatchLogsEvent {
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	return events.CloudwatchLogsEvent{
+		AWSLogs: events.CloudwatchLogsRawData{Data: base64.StdEncoding.EncodeToString(compressBody(t, encodingGzip, raw))},
+	}
+}
+
+func TestCloudwatchLogsDecoded(t *testing.T) {
+	data := &events.CloudwatchLogsData{
+		Owner:       "123456789012",
+		LogGroup:    "/aws/lambda/app",
+		LogStream:   "2024/01/01/[$LATEST]abc",
+		MessageType: "DATA_MESSAGE",
+		LogEvents: []events.CloudwatchLogsLogEvent{
+			{ID: "1", Timestamp: 1700000000000, Message: "first"},
+			{ID: "2", Timestamp: 1700000000001, Message: "second"},
+		},
+	}
+
+	var attrs map[string]string
+	var received events.CloudwatchLogsData
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeCloudwatchLogs}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		require.NoError(t, p.decode(pld.Context, &attrs))
+		require.NoError(t, json.Unmarshal(pld.Body, &received))
+
+		return &payload.Payload{}, nil
+	})
+
+	require.NoError(t, p.cloudwatchLogsHandler()(testContext(), logsEvent(t, data)))
+	assert.Equal(t, *data, received)
+	assert.Equal(t, "123456789012", attrs[attrOwner])
+	assert.Equal(t, "/aws/lambda/app", attrs[attrLogGroup])
+	assert.Equal(t, "2024/01/01/[$LATEST]abc", attrs[attrLogStream])
+	assert.Equal(t, "DATA_MESSAGE", attrs[attrMessageType])
+}
+
+func TestCloudwatchLogsErrors(t *testing.T) {
+	called := 0
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeCloudwatchLogs, MaxBodySize: 256}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		called++
+		return nil, errors.Str("worker failed")
+	})
+
+	handler := p.cloudwatchLogsHandler()
+
+	tests := map[string]events.CloudwatchLogsEvent{
+		"invalid base64": {AWSLogs: events.CloudwatchLogsRawData{Data: "%%%"}},
+		"not gzipped":    {AWSLogs: events.CloudwatchLogsRawData{Data: base64.StdEncoding.EncodeToString([]byte(`{}`))}},
+		"over the limit": logsEvent(t, &events.CloudwatchLogsData{LogEvents: []events.CloudwatchLogsLogEvent{{Message: string(make([]byte, 256))}}}),
+	}
+
+	for name, event := range tests {
+		assert.Error(t, handler(testContext(), event), name)
+	}
+	assert.Zero(t, called)
+
+	// the worker errors are returned to make lambda retry
+	assert.Error(t, handler(testContext(), logsEvent(t, &events.CloudwatchLogsData{Owner: "1"})))
+	assert.Equal(t, 1, called)
+}
+
+func TestParseLogs(t *testing.T) {
+	data := &events.CloudwatchLogsData{
+		LogGroup:  "/aws/lambda/app",
+		LogEvents: []events.CloudwatchLogsLogEvent{{ID: "1", Message: string(make([]byte, 512))}},
+	}
+
+	tests := []struct {
+		name   string
+		limit  int64
+		status int
+	}{
+		{name: "unlimited", limit: 0},
+		{name: "within the limit", limit: 1 << 20},
+		// the decoded size is checked, not the compressed one
+		{name: "over the limit", limit: 512, status: 413},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{cfg: &Config{MaxBodySize: tt.limit}}
+
+			event := logsEvent(t, data)
+			require.Less(t, int64(len(event.AWSLogs.Data)), int64(512))
+
+			out, err := p.parseLogs(&event)
+			if tt.status != 0 {
+				var se *statusError
+				require.ErrorAs(t, err, &se)
+				assert.Equal(t, tt.status, se.status)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, data, out)
+		})
+	}
+}
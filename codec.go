@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/goridge/v3/pkg/frame"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// codecFlag returns the goridge frame codec flag for the configured codec
+func codecFlag(codec string) byte {
+	switch codec {
+	case codecProto:
+		return frame.CodecProto
+	case codecMsgpack:
+		return frame.CodecMsgpack
+	default:
+		return frame.CodecJSON
+	}
+}
+
+// encode marshals v into buf using the configured codec.
+// proto payloads are sent as google.protobuf.Struct since lambda events have no dedicated proto schema
+func (p *Plugin) encode(buf *bytes.Buffer, v any) error {
+	if p.cfg.Codec == codecMsgpack {
+		enc := msgpack.NewEncoder(buf)
+		// lambda events only carry the json tags
+		enc.SetCustomStructTag("json")
+		return enc.Encode(v)
+	}
+
+	enc := json.NewEncoder(buf)
+	// the worker should get the values as is (a < b, not a \u003c b)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	// drop the trailing newline written by the encoder
+	buf.Truncate(buf.Len() - 1)
+
+	if p.cfg.Codec != codecProto {
+		return nil
+	}
+
+	st := &structpb.Struct{}
+	err = protojson.Unmarshal(buf.Bytes(), st)
+	if err != nil {
+		return err
+	}
+
+	buf.Reset()
+	data, err := proto.MarshalOptions{}.MarshalAppend(buf.AvailableBuffer(), st)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write(data)
+	return err
+}
+
+// encodeRaw writes the JSON document into buf using the configured codec
+func (p *Plugin) encodeRaw(buf *bytes.Buffer, data json.RawMessage) error {
+	if p.cfg.Codec == codecJSON {
+		_, err := buf.Write(data)
+		return err
+	}
+
+	var v any
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	return p.encode(buf, v)
+}
+
+// decode unmarshals the worker response into v using the configured codec
+func (p *Plugin) decode(data []byte, v any) error {
+	switch p.cfg.Codec {
+	case codecMsgpack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	case codecProto:
+		st := &structpb.Struct{}
+		err := proto.Unmarshal(data, st)
+		if err != nil {
+			return err
+		}
+
+		data, err = protojson.Marshal(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/goridge/v3/pkg/frame"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecFlag(t *testing.T) {
+	assert.Equal(t, byte(frame.CodecJSON), codecFlag(codecJSON))
+	assert.Equal(t, byte(frame.CodecProto), codecFlag(codecProto))
+	assert.Equal(t, byte(frame.CodecMsgpack), codecFlag(codecMsgpack))
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	type message struct {
+		StatusCode int               `json:"statusCode"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body"`
+	}
+
+	in := &message{StatusCode: 201, Headers: map[string]string{"Content-Type": "text/plain"}, Body: "created"}
+
+	for _, codec := range []string{codecJSON, codecProto, codecMsgpack} {
+		t.Run(codec, func(t *testing.T) {
+			p := &Plugin{cfg: &Config{Codec: codec}}
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, p.encode(buf, in))
+
+			out := &message{}
+			require.NoError(t, p.decode(buf.Bytes(), out))
+			assert.Equal(t, in, out)
+		})
+	}
+}
+
+func TestEncodeJSONWithoutTrailingNewline(t *testing.T) {
+	p := &Plugin{cfg: &Config{Codec: codecJSON}}
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, p.encode(buf, map[string]string{"a": "b"}))
+	assert.Equal(t, `{"a":"b"}`, buf.String())
+}
+
+func TestEncodeMsgpackUsesJSONTags(t *testing.T) {
+	p := &Plugin{cfg: &Config{Codec: codecMsgpack}}
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, p.encode(buf, struct {
+		RawPath string `json:"rawPath"`
+	}{RawPath: "/users"}))
+
+	var out map[string]any
+	require.NoError(t, p.decode(buf.Bytes(), &out))
+	assert.Equal(t, map[string]any{"rawPath": "/users"}, out)
+}
+
+func TestDecodeInvalidPayload(t *testing.T) {
+	for _, codec := range []string{codecJSON, codecProto, codecMsgpack} {
+		p := &Plugin{cfg: &Config{Codec: codec}}
+
+		var out map[string]any
+		assert.Error(t, p.decode([]byte{0xff, 0x00, 0x01}, &out), codec)
+	}
+}
+
+func TestEncodeRaw(t *testing.T) {
+	event := json.RawMessage(`{"source":"aws.events","detail":{"id":1}}`)
+
+	for _, codec := range []string{codecJSON, codecProto, codecMsgpack} {
+		t.Run(codec, func(t *testing.T) {
+			p := &Plugin{cfg: &Config{Codec: codec}}
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, p.encodeRaw(buf, event))
+
+			var out map[string]any
+			require.NoError(t, p.decode(buf.Bytes(), &out))
+			assert.Equal(t, "aws.events", out["source"])
+		})
+	}
+}
+
+func TestMsgpackMatchesProto(t *testing.T) {
+	request := testRequest("/users")
+	request.QueryStringParameters = map[string]string{"page": "1"}
+	request.Cookies = []string{"a=1"}
+	request.Body = `{"name":"test"}`
+
+	decoded := make(map[string]events.APIGatewayV2HTTPRequest, 2)
+	for _, codec := range []string{codecProto, codecMsgpack} {
+		p := &Plugin{cfg: &Config{Codec: codec}}
+
+		buf := new(bytes.Buffer)
+		require.NoError(t, p.encode(buf, request))
+
+		var out events.APIGatewayV2HTTPRequest
+		require.NoError(t, p.decode(buf.Bytes(), &out))
+		decoded[codec] = out
+	}
+
+	assert.Equal(t, decoded[codecProto], decoded[codecMsgpack])
+	assert.Equal(t, request.RawPath, decoded[codecMsgpack].RawPath)
+	assert.Equal(t, request.Cookies, decoded[codecMsgpack].Cookies)
+	assert.Equal(t, request.Body, decoded[codecMsgpack].Body)
+}
+
+func TestEncodeWithoutHTMLEscape(t *testing.T) {
+	request := testRequest("/search")
+	request.RawQueryString = "q=a<b&c>d"
+	request.Body = `<p title="x">&amp;</p>`
+
+	for _, codec := range []string{codecJSON, codecProto} {
+		t.Run(codec, func(t *testing.T) {
+			p := &Plugin{cfg: &Config{Codec: codec}}
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, p.encode(buf, request))
+
+			// the values reach the worker as is, not as the \u003c escapes
+			assert.NotContains(t, buf.String(), `\u003c`)
+			assert.NotContains(t, buf.String(), `\u0026`)
+			assert.Contains(t, buf.String(), "q=a<b&c>d")
+
+			var out events.APIGatewayV2HTTPRequest
+			require.NoError(t, p.decode(buf.Bytes(), &out))
+			assert.Equal(t, request.RawQueryString, out.RawQueryString)
+			assert.Equal(t, request.Body, out.Body)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	attrTriggerSource string = "trigger_source"
+	attrUserPoolID    string = "user_pool_id"
+	attrUserName      string = "user_name"
+)
+
+// cognitoHandler handles the Cognito user pool triggers (pre sign-up, pre token generation, etc.).
+// The worker receives the whole event and responds with the fields to set in the event `response` object,
+// e.g. {"autoConfirmUser": true} for the pre sign-up trigger. The mutated event is returned to Cognito
+func (p *Plugin) cognitoHandler() func(ctx context.Context, event json.RawMessage) (map[string]any, error) {
+	return func(ctx context.Context, event json.RawMessage) (map[string]any, error) {
+		const op = errors.Op("lambda_cognito_handler")
+
+		var header events.CognitoEventUserPoolsHeader
+		err := json.Unmarshal(event, &header)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		if header.TriggerSource == "" {
+			return nil, errors.E(op, errors.Str("not a cognito user pool event: triggerSource is empty"))
+		}
+
+		var ev map[string]any
+		err = json.Unmarshal(event, &ev)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		if !p.acquire() {
+			return nil, errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+		attrs[attrRequestID] = requestID(ctx)
+		attrs[attrTriggerSource] = header.TriggerSource
+		attrs[attrUserPoolID] = header.UserPoolID
+		attrs[attrUserName] = header.UserName
+
+		var mutations map[string]any
+		err = p.invoke(ctx, p.wrkPool, event, attrs, &mutations)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		// the response object is null or empty in the incoming event
+		response, ok := ev["response"].(map[string]any)
+		if !ok || response == nil {
+			response = make(map[string]any, len(mutations))
+		}
+
+		for k, v := range mutations {
+			response[k] = v
+		}
+
+		ev["response"] = response
+
+		return ev, nil
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCognitoPreSignupAutoConfirm(t *testing.T) {
+	var attrs map[string]string
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeCognito}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		require.NoError(t, p.decode(pld.Context, &attrs))
+
+		var ev events.CognitoEventUserPoolsPreSignup
+		require.NoError(t, json.Unmarshal(pld.Body, &ev))
+		assert.Equal(t, "user@example.com", ev.Request.UserAttributes["email"])
+
+		return &payload.Payload{Body: []byte(`{"autoConfirmUser":true,"autoVerifyEmail":true}`)}, nil
+	})
+
+	event, err := json.Marshal(events.CognitoEventUserPoolsPreSignup{
+		CognitoEventUserPoolsHeader: events.CognitoEventUserPoolsHeader{
+			Version:       "1",
+			TriggerSource: "PreSignUp_SignUp",
+			Region:        "us-east-1",
+			UserPoolID:    "us-east-1_abc",
+			UserName:      "user",
+		},
+		Request: events.CognitoEventUserPoolsPreSignupRequest{
+			UserAttributes: map[string]string{"email": "user@example.com"},
+		},
+	})
+	require.NoError(t, err)
+
+	out, err := lambda.NewHandler(p.cognitoHandler()).Invoke(testContext(), event)
+	require.NoError(t, err)
+
+	var rsp events.CognitoEventUserPoolsPreSignup
+	require.NoError(t, json.Unmarshal(out, &rsp))
+	assert.True(t, rsp.Response.AutoConfirmUser)
+	assert.True(t, rsp.Response.AutoVerifyEmail)
+	assert.False(t, rsp.Response.AutoVerifyPhone)
+	assert.Equal(t, "PreSignUp_SignUp", rsp.TriggerSource)
+	assert.Equal(t, "user@example.com", rsp.Request.UserAttributes["email"])
+
+	assert.Equal(t, "PreSignUp_SignUp", attrs[attrTriggerSource])
+	assert.Equal(t, "us-east-1_abc", attrs[attrUserPoolID])
+	assert.Equal(t, "user", attrs[attrUserName])
+}
+
+func TestCognitoRejectsOtherEvents(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeCognito}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		t.Fatal("the worker should not be called")
+		return nil, nil
+	})
+
+	_, err := lambda.NewHandler(p.cognitoHandler()).Invoke(testContext(), []byte(`{"source":"aws.events"}`))
+	assert.ErrorContains(t, err, "triggerSource is empty")
+}
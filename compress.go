@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	encodingGzip string = "gzip"
+	// responses smaller than this are not worth compressing
+	minCompressSize int = 1024
+)
+
+// acceptsGzip reports whether the Accept-Encoding header value allows the gzip encoding.
+// The explicit gzip entry takes precedence over the * one (*;q=0, gzip accepts gzip)
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+
+	for _, t := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(t, ";")
+		name = strings.TrimSpace(name)
+
+		switch {
+		case strings.EqualFold(name, encodingGzip):
+			gzipQ = qvalue(params)
+		case name == "*":
+			anyQ = qvalue(params)
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+
+	return anyQ > 0
+}
+
+// qvalue returns the weight of the Accept-Encoding entry parameters (q=0.5), 1 when absent and 0 when malformed
+func qvalue(params string) float64 {
+	q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+	if !ok {
+		return 1
+	}
+
+	qv, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0
+	}
+
+	return qv
+}
+
+// compress gzips the response body when the client accepts it, the body becomes base64 encoded.
+// The bodies already encoded by the worker are passed as is
+func (p *Plugin) compress(request *events.APIGatewayV2HTTPRequest, response *events.APIGatewayV2HTTPResponse) {
+	if !p.cfg.Compress || len(response.Body) < minCompressSize || contentEncoded(getHeader(response.Headers, "content-encoding")) || !acceptsGzip(getHeader(request.Headers, "accept-encoding")) {
+		return
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		var err error
+		body, err = decodeBase64(response.Body)
+		if err != nil {
+			return
+		}
+	}
+
+	buf := p.getBuf()
+	defer p.putBuf(buf)
+
+	gw := gzip.NewWriter(buf)
+	_, err := gw.Write(body)
+	if err != nil {
+		return
+	}
+
+	err = gw.Close()
+	if err != nil {
+		return
+	}
+
+	if response.Headers == nil {
+		response.Headers = make(map[string]string, 2)
+	}
+
+	response.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+	response.IsBase64Encoded = true
+	setHeader(response.Headers, "Content-Encoding", encodingGzip)
+	// the worker length is the uncompressed one
+	delHeader(response.Headers, "content-length")
+
+	// shared caches must not serve the compressed body to the clients which didn't ask for it
+	vary := getHeader(response.Headers, "vary")
+	switch {
+	case vary == "":
+		setHeader(response.Headers, "Vary", "Accept-Encoding")
+	case vary == "*", hasToken(vary, "accept-encoding"):
+		setHeader(response.Headers, "Vary", vary)
+	default:
+		setHeader(response.Headers, "Vary", vary+", Accept-Encoding")
+	}
+}
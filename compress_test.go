@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "gzip", want: true},
+		{header: "GZIP", want: true},
+		{header: "deflate, gzip;q=1.0, br", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "gzip;q=0.5", want: true},
+		{header: "gzip;q=abc", want: false},
+		{header: "br, deflate", want: false},
+		{header: "*", want: true},
+		{header: "*;q=0", want: false},
+		// the explicit gzip entry takes precedence over *
+		{header: "*;q=0, gzip", want: true},
+		{header: "gzip, *;q=0", want: true},
+		{header: "gzip;q=0, *", want: false},
+		{header: "identity;q=1, *;q=0.1", want: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, acceptsGzip(tt.header), tt.header)
+	}
+}
+
+func TestCompressVary(t *testing.T) {
+	body := strings.Repeat("compressible ", 200)
+
+	tests := []struct {
+		name          string
+		vary          string
+		contentLength bool
+		want          string
+	}{
+		{name: "no vary", want: "Accept-Encoding"},
+		{name: "worker content length", contentLength: true, want: "Accept-Encoding"},
+		{name: "merged", vary: "Origin", want: "Origin, Accept-Encoding"},
+		{name: "already present", vary: "origin, accept-encoding", want: "origin, accept-encoding"},
+		{name: "any", vary: "*", want: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"content-type": "text/plain"}
+			if tt.vary != "" {
+				headers["vary"] = tt.vary
+			}
+			if tt.contentLength {
+				headers["Content-Length"] = strconv.Itoa(len(body))
+			}
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{Compress: true}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: headers, Body: body}, nil))
+
+			request := testRequest("/users")
+			request.Headers["accept-encoding"] = "gzip, br"
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.want, rsp.Headers["Vary"])
+			assert.Equal(t, "gzip", rsp.Headers["Content-Encoding"])
+			// the uncompressed length is not sent with the compressed body
+			assert.Empty(t, getHeader(rsp.Headers, "content-length"))
+			require.True(t, rsp.IsBase64Encoded)
+
+			data, err := base64.StdEncoding.DecodeString(rsp.Body)
+			require.NoError(t, err)
+
+			gr, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+
+			plain, err := io.ReadAll(gr)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(plain))
+		})
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		headers        map[string]string
+		body           string
+	}{
+		{name: "not accepted", acceptEncoding: "br", body: strings.Repeat("a", 2048)},
+		{name: "small body", acceptEncoding: "gzip", body: "small"},
+		{name: "encoded by the worker", acceptEncoding: "gzip", headers: map[string]string{"content-encoding": "br"}, body: strings.Repeat("a", 2048)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{Compress: true}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: tt.headers, Body: tt.body}, nil))
+
+			request := testRequest("/users")
+			request.Headers["accept-encoding"] = tt.acceptEncoding
+
+			rsp := serve(t, p, request)
+			assert.NotEqual(t, "gzip", rsp.Headers["Content-Encoding"])
+			assert.NotContains(t, rsp.Headers, "Vary")
+		})
+	}
+}
+
+func TestCompressedByTheWorker(t *testing.T) {
+	plain := strings.Repeat("compressible ", 200)
+	compressed := compressBody(t, encodingGzip, []byte(plain))
+
+	for _, compress := range []bool{false, true} {
+		// msgpack carries the binary body as is, json would replace the invalid UTF-8
+		p := &Plugin{}
+		newTestPlugin(t, p, &Config{Compress: compress, Codec: codecMsgpack}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+			buf := new(bytes.Buffer)
+			err := p.encode(buf, events.APIGatewayV2HTTPResponse{
+				StatusCode: 200,
+				Headers:    map[string]string{"Content-Type": "text/plain", "Content-Encoding": "gzip"},
+				Body:       string(compressed),
+			})
+
+			return &payload.Payload{Body: buf.Bytes()}, err
+		})
+
+		request := testRequest("/users")
+		request.Headers["accept-encoding"] = "gzip"
+
+		rsp := serve(t, p, request)
+		assert.Equal(t, "gzip", rsp.Headers["Content-Encoding"])
+		// the compressed body is binary, it is passed through untouched
+		require.True(t, rsp.IsBase64Encoded)
+
+		data, err := base64.StdEncoding.DecodeString(rsp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, compressed, data, "compress: %v", compress)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/pool"
+)
+
+const (
+	codecJSON    string = "json"
+	codecProto   string = "proto"
+	codecMsgpack string = "msgpack"
+
+	eventTypeHTTP           string = "http"
+	eventTypeRaw            string = "raw"
+	eventTypeCognito        string = "cognito"
+	eventTypeWebsocket      string = "websocket"
+	eventTypeCloudwatchLogs string = "cloudwatch_logs"
+	eventTypeALB            string = "alb"
+	eventTypeKafka          string = "kafka"
+	eventTypeSQS            string = "sqs"
+
+	otelExporterStdout string = "stdout"
+	otelExporterStderr string = "stderr"
+
+	defaultMaxHeaders     int = 1000
+	defaultMaxHeaderBytes int = 1 << 20
+	defaultRawEventSize   int = 64 << 10
+	// the lambda response payload limit
+	defaultMaxResponseSize int = 6 << 20
+
+	defaultNumWorkers      uint64        = 4
+	defaultAllocateTimeout time.Duration = time.Second * 20
+	defaultDestroyTimeout  time.Duration = time.Second * 20
+)
+
+// Config represents the lambda plugin configuration (.rr.yaml, `lambda` section)
+type Config struct {
+	// Codec used to encode the payloads sent to the worker and to decode the worker responses: json, proto or msgpack.
+	// Defaults to json, not proto: the handler has always sent json to the worker, so the existing workers keep working
+	Codec string `mapstructure:"codec"`
+	// DecodePath replaces the percent-encoded RawPath with its decoded form before it is sent to the worker
+	DecodePath bool `mapstructure:"decode_path"`
+	// StripStage removes the named stage segment from the request path (/prod/users -> /users),
+	// the stage is sent to the worker in the X-Forwarded-Prefix header
+	StripStage bool `mapstructure:"strip_stage"`
+	// BasePath is the custom domain API mapping path (e.g. /api), removed from the request path (/api/users -> /users)
+	// and sent to the worker in the X-Forwarded-Prefix header. Takes precedence over StripStage
+	BasePath string `mapstructure:"base_path"`
+	// ForwardedHost sets the X-Forwarded-Host request header: auto (the Host header or the API Gateway domain,
+	// the client value is kept), domain (the API Gateway domain) or the literal host. Not set when empty
+	ForwardedHost string `mapstructure:"forwarded_host"`
+	// KeepHopByHopHeaders sends the hop-by-hop request headers (Connection, Keep-Alive, Transfer-Encoding, Upgrade, etc.)
+	// to the worker, they are removed by default
+	KeepHopByHopHeaders bool `mapstructure:"keep_hop_by_hop_headers"`
+	// StripAuthorization removes the Authorization header from the requests validated by an API Gateway authorizer,
+	// the worker gets the authorizer context (e.g. the JWT claims) only
+	StripAuthorization bool `mapstructure:"strip_authorization"`
+	// ForwardedHeaders toggles the forwarding request headers set from the request context, all enabled by default
+	ForwardedHeaders ForwardedHeadersConfig `mapstructure:"forwarded_headers"`
+	// BinaryMediaTypes lists the media types (wildcards like image/* and */* are allowed) treated as binary,
+	// binary request bodies are sent to the worker base64 encoded, binary response bodies are base64 encoded.
+	// Only the text request bodies (text/*, json, xml, form) API Gateway encoded are decoded for the worker
+	BinaryMediaTypes []string `mapstructure:"binary_media_types"`
+	// BinarySafe base64 encodes all the response bodies regardless of the content type,
+	// the API Gateway binary media types should be */*
+	BinarySafe bool `mapstructure:"binary_safe"`
+	// MaxConcurrency limits the number of simultaneous worker executions, requests above the limit get 503. 0 - unlimited
+	MaxConcurrency uint64 `mapstructure:"max_concurrency"`
+	// Routes send the requests with the matching path prefix to the dedicated pools (longest prefix wins),
+	// unmatched requests are handled by the default pool
+	Routes []*Route `mapstructure:"routes"`
+	// HealthPath is the request path answered by the plugin itself with the workers status, disabled when empty
+	HealthPath string `mapstructure:"health_path"`
+	// PoweredBy adds the X-Powered-By header with the plugin version to the responses
+	PoweredBy bool `mapstructure:"powered_by"`
+	// Compress gzips the responses for the clients sending Accept-Encoding: gzip
+	Compress bool `mapstructure:"compress"`
+	// Env is added to the workers environment (on top of the process and server environment)
+	Env map[string]string `mapstructure:"env"`
+	// DecompressRequest decodes the request bodies sent with Content-Encoding: gzip, deflate or br
+	DecompressRequest bool `mapstructure:"decompress_request"`
+	// EventType defines the expected lambda events: http (API Gateway HTTP API with the payload format 2.0 or 1.0
+	// and REST API), raw (any JSON, passed to the worker as is), cognito (user pool triggers), websocket (API Gateway
+	// WebSocket API), cloudwatch_logs (logs subscription), alb (Application Load Balancer), kafka (MSK and self-managed Kafka)
+	// or sqs. Custom event types are added by the plugins implementing EventHandler. Unknown types fail Serve
+	EventType string `mapstructure:"event_type"`
+	// MaxBodySize is the max (decoded) request body size in bytes, larger requests get 413. 0 - unlimited
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+	// ValidateJSON rejects the application/json requests with a malformed body (400) before calling the worker
+	ValidateJSON bool `mapstructure:"validate_json"`
+	// MaxHeaders is the max number of the request headers (and cookies), larger requests get 431.
+	// 0 - the default (1000), negative - unlimited
+	MaxHeaders int `mapstructure:"max_headers"`
+	// MaxHeaderBytes is the max total size of the request header (and cookie) names and values, larger requests get 431.
+	// 0 - the default (1 MB), negative - unlimited
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+	// ResponseHeaders are added to every API Gateway http and ALB response (not to the websocket route responses),
+	// the worker headers with the same name take precedence unless ResponseHeadersOverride is set
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+	// ResponseHeadersOverride makes the ResponseHeaders replace the worker headers with the same name
+	ResponseHeadersOverride bool `mapstructure:"response_headers_override"`
+	// PassRawEvent sends the JSON of the original http event to the worker in the lambda_raw_event attribute, for debugging
+	PassRawEvent bool `mapstructure:"pass_raw_event"`
+	// RawEventMaxSize is the max size in bytes of the lambda_raw_event attribute, the larger events are truncated
+	RawEventMaxSize int `mapstructure:"raw_event_max_size"`
+	// MaxResponseSize is the max size in bytes of the final http response (body as sent, headers and cookies),
+	// larger responses get 502. Defaults to the 6MB lambda limit, -1 - unlimited
+	MaxResponseSize int `mapstructure:"max_response_size"`
+	// MaxResponseHeaderBytes is the max total size of the response header and cookie names and values,
+	// larger responses get 502. 0 - unlimited
+	MaxResponseHeaderBytes int `mapstructure:"max_response_header_bytes"`
+	// DefaultContentType is the Content-Type of the response bodies the worker sent without one, not set when empty
+	DefaultContentType string `mapstructure:"default_content_type"`
+	// RequestTimeout limits the worker execution time (capped by the lambda deadline), the worker exceeding it
+	// is killed and replaced, the request gets 504. 0 - only the lambda deadline applies
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// Pool configures the workers pools (the default and the routes ones), pool.command is ignored
+	Pool *pool.Config `mapstructure:"pool"`
+	// SlowThreshold logs a warning for the http requests the worker handled longer than the threshold, disabled when 0
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// ResetSentinel is the file checked (stat) before each http request, the workers are reset when its modification
+	// time changes, e.g. to reload the code updated in the warm container. Disabled when empty
+	ResetSentinel string `mapstructure:"reset_sentinel"`
+	// Timeout configures the responses to the requests which exceeded the request_timeout or the lambda deadline (504)
+	Timeout TimeoutConfig `mapstructure:"timeout"`
+	// BatchItemFailures reports the failed sqs messages individually (the event source mapping should have
+	// ReportBatchItemFailures enabled), otherwise the first failure fails the whole batch
+	BatchItemFailures bool `mapstructure:"batch_item_failures"`
+	// Uploads limits the multipart requests
+	Uploads UploadsConfig `mapstructure:"uploads"`
+	// Idempotency skips the repeatedly delivered sqs messages
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	// Otel configures the OpenTelemetry tracing of the http events
+	Otel OtelConfig `mapstructure:"otel"`
+}
+
+// OtelConfig represents the `lambda.otel` section
+type OtelConfig struct {
+	// Enabled starts a span per http request, the spans are exported synchronously by the plugin tracer provider
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter writes the finished spans as JSON lines: stdout (CloudWatch Logs, default) or stderr
+	Exporter string `mapstructure:"exporter"`
+	// ServiceName is the service.name resource attribute, the AWS_LAMBDA_FUNCTION_NAME by default
+	ServiceName string `mapstructure:"service_name"`
+}
+
+// IdempotencyConfig represents the `lambda.idempotency` section
+type IdempotencyConfig struct {
+	// Key identifies the message: message_id, deduplication_id (FIFO queues) or the name of the message attribute
+	Key string `mapstructure:"key"`
+	// TTL is how long the processed keys are remembered (in the container memory), disabled when 0
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// ForwardedHeadersConfig represents the `lambda.forwarded_headers` section, all the headers are enabled by default.
+// The source ip and the Forwarded element are appended to the client values (the proxy chain is kept),
+// the worker should trust only the last entry
+type ForwardedHeadersConfig struct {
+	// For appends the source ip to X-Forwarded-For
+	For *bool `mapstructure:"x_forwarded_for"`
+	// Proto sets X-Forwarded-Proto: https
+	Proto *bool `mapstructure:"x_forwarded_proto"`
+	// Forwarded appends the RFC 7239 Forwarded element (for, host, proto)
+	Forwarded *bool `mapstructure:"forwarded"`
+}
+
+// UploadsConfig represents the `lambda.uploads` section
+type UploadsConfig struct {
+	// MaxParts is the max number of the multipart parts (values and files combined), more parts get 400. 0 - unlimited
+	MaxParts int `mapstructure:"max_parts"`
+}
+
+// TimeoutConfig represents the `lambda.timeout` section
+type TimeoutConfig struct {
+	// IncludeLateResponse adds the worker response completed after the deadline to the 504 body, for debugging.
+	// Only the json codec is supported, the worker output isn't streamed, so there is nothing to add when it didn't complete
+	IncludeLateResponse bool `mapstructure:"include_late_response"`
+}
+
+// InitDefaults sets the default values and validates the configuration
+func (c *Config) InitDefaults() error {
+	if c.Codec == "" {
+		c.Codec = codecJSON
+	}
+
+	c.Codec = strings.ToLower(c.Codec)
+
+	if c.EventType == "" {
+		c.EventType = eventTypeHTTP
+	}
+
+	c.EventType = strings.ToLower(c.EventType)
+
+	for k, v := range c.Env {
+		c.Env[k] = os.Expand(v, os.Getenv)
+	}
+
+	for i := 0; i < len(c.BinaryMediaTypes); i++ {
+		c.BinaryMediaTypes[i] = strings.ToLower(strings.TrimSpace(c.BinaryMediaTypes[i]))
+	}
+
+	if c.Otel.Exporter == "" {
+		c.Otel.Exporter = otelExporterStdout
+	}
+
+	if c.Otel.ServiceName == "" {
+		c.Otel.ServiceName = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	}
+
+	switch c.Otel.Exporter {
+	case otelExporterStdout, otelExporterStderr:
+	default:
+		return errors.Errorf("unknown otel exporter: %s, supported exporters: stdout, stderr", c.Otel.Exporter)
+	}
+
+	switch c.Codec {
+	case codecJSON, codecProto, codecMsgpack:
+	default:
+		return errors.Errorf("unknown codec: %s, supported codecs: json, proto, msgpack", c.Codec)
+	}
+
+	for _, v := range []**bool{&c.ForwardedHeaders.For, &c.ForwardedHeaders.Proto, &c.ForwardedHeaders.Forwarded} {
+		if *v == nil {
+			enabled := true
+			*v = &enabled
+		}
+	}
+
+	if c.Pool == nil {
+		c.Pool = &pool.Config{}
+	}
+
+	if c.Pool.NumWorkers == 0 {
+		c.Pool.NumWorkers = defaultNumWorkers
+	}
+
+	if c.Pool.AllocateTimeout == 0 {
+		c.Pool.AllocateTimeout = defaultAllocateTimeout
+	}
+
+	if c.Pool.DestroyTimeout == 0 {
+		c.Pool.DestroyTimeout = defaultDestroyTimeout
+	}
+
+	// the root mapping has nothing to remove
+	if c.BasePath = strings.Trim(c.BasePath, "/"); c.BasePath != "" {
+		c.BasePath = "/" + c.BasePath
+	}
+
+	if c.MaxHeaders == 0 {
+		c.MaxHeaders = defaultMaxHeaders
+	}
+
+	if c.MaxHeaderBytes == 0 {
+		c.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+
+	if c.MaxResponseSize == 0 {
+		c.MaxResponseSize = defaultMaxResponseSize
+	}
+
+	if c.RawEventMaxSize <= 0 {
+		c.RawEventMaxSize = defaultRawEventSize
+	}
+
+	if c.Idempotency.TTL > 0 && c.Idempotency.Key == "" {
+		c.Idempotency.Key = idempotencyMessageID
+	}
+
+	for i := 0; i < len(c.Routes); i++ {
+		if c.Routes[i].Prefix == "" {
+			return errors.Str("route prefix should not be empty")
+		}
+
+		if len(c.Routes[i].Command) == 0 {
+			return errors.Errorf("route %s: command should not be empty", c.Routes[i].Prefix)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/pool/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitDefaultsCodec(t *testing.T) {
+	tests := []struct {
+		codec   string
+		want    string
+		wantErr bool
+	}{
+		// json, not proto: the workers have always received json
+		{codec: "", want: codecJSON},
+		{codec: "json", want: codecJSON},
+		{codec: "PROTO", want: codecProto},
+		{codec: "msgpack", want: codecMsgpack},
+		{codec: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Codec: tt.codec}
+		err := cfg.InitDefaults()
+		if tt.wantErr {
+			assert.Error(t, err, tt.codec)
+			continue
+		}
+
+		require.NoError(t, err, tt.codec)
+		assert.Equal(t, tt.want, cfg.Codec)
+	}
+}
+
+func TestEnvReachesThePools(t *testing.T) {
+	t.Setenv("TEST_DB_HOST", "db.internal")
+
+	var envs []map[string]string
+	p := &Plugin{}
+	setTestPools(t, p, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	factory := p.poolFactory
+	p.poolFactory = func(ctx context.Context, cfg *pool.Config, env map[string]string) (Pool, error) {
+		envs = append(envs, env)
+		return factory(ctx, cfg, env)
+	}
+
+	startTestPlugin(t, p, &Config{
+		Env:    map[string]string{"APP_ENV": "prod", "DB_HOST": "${TEST_DB_HOST}"},
+		Routes: []*Route{{Prefix: "/admin", Command: []string{"php", "admin.php"}}},
+	})
+
+	// the default and the route pool
+	require.Len(t, envs, 2)
+	for i := 0; i < len(envs); i++ {
+		assert.Equal(t, map[string]string{"APP_ENV": "prod", "DB_HOST": "db.internal"}, envs[i])
+	}
+}
+
+func TestInitDefaultsPool(t *testing.T) {
+	tests := []struct {
+		name string
+		pool *pool.Config
+		want *pool.Config
+	}{
+		{
+			name: "not configured",
+			want: &pool.Config{NumWorkers: 4, AllocateTimeout: time.Second * 20, DestroyTimeout: time.Second * 20},
+		},
+		{
+			name: "partially configured",
+			pool: &pool.Config{NumWorkers: 2, MaxJobs: 100},
+			want: &pool.Config{NumWorkers: 2, MaxJobs: 100, AllocateTimeout: time.Second * 20, DestroyTimeout: time.Second * 20},
+		},
+		{
+			name: "configured",
+			pool: &pool.Config{NumWorkers: 8, AllocateTimeout: time.Second, DestroyTimeout: time.Second * 5},
+			want: &pool.Config{NumWorkers: 8, AllocateTimeout: time.Second, DestroyTimeout: time.Second * 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Pool: tt.pool}
+			require.NoError(t, cfg.InitDefaults())
+			assert.Equal(t, tt.want, cfg.Pool)
+		})
+	}
+}
+
+func TestInitDefaultsForwardedHeaders(t *testing.T) {
+	off := false
+	cfg := &Config{ForwardedHeaders: ForwardedHeadersConfig{Proto: &off}}
+	require.NoError(t, cfg.InitDefaults())
+
+	// the unset toggles are enabled, the configured ones are kept
+	require.NotNil(t, cfg.ForwardedHeaders.For)
+	require.NotNil(t, cfg.ForwardedHeaders.Forwarded)
+	assert.True(t, *cfg.ForwardedHeaders.For)
+	assert.False(t, *cfg.ForwardedHeaders.Proto)
+	assert.True(t, *cfg.ForwardedHeaders.Forwarded)
+}
+
+func TestPoolConfigReachesThePools(t *testing.T) {
+	var cfgs []*pool.Config
+	p := &Plugin{}
+	setTestPools(t, p, nil)
+	p.poolFactory = func(_ context.Context, cfg *pool.Config, _ map[string]string) (Pool, error) {
+		cfgs = append(cfgs, cfg)
+		return newTestPool(t, cfg, nil), nil
+	}
+
+	supervisor := &pool.SupervisorConfig{MaxWorkerMemory: 256}
+	startTestPlugin(t, p, &Config{
+		Pool: &pool.Config{
+			Command:         []string{"ignored"},
+			NumWorkers:      2,
+			MaxJobs:         50,
+			AllocateTimeout: time.Second * 3,
+			DestroyTimeout:  time.Second * 7,
+			Supervisor:      supervisor,
+		},
+		Routes: []*Route{{Prefix: "/admin", Command: []string{"php", "admin.php"}}},
+	})
+
+	// the default and the route pool
+	require.Len(t, cfgs, 2)
+	assert.Nil(t, cfgs[0].Command)
+	assert.Equal(t, []string{"php", "admin.php"}, cfgs[1].Command)
+	for i := 0; i < len(cfgs); i++ {
+		assert.Equal(t, uint64(2), cfgs[i].NumWorkers)
+		assert.Equal(t, uint64(50), cfgs[i].MaxJobs)
+		assert.Equal(t, time.Second*3, cfgs[i].AllocateTimeout)
+		assert.Equal(t, time.Second*7, cfgs[i].DestroyTimeout)
+		assert.Equal(t, uint64(256), cfgs[i].Supervisor.MaxWorkerMemory)
+	}
+
+	// every pool gets its own copy
+	assert.NotSame(t, cfgs[0], cfgs[1])
+	assert.NotSame(t, cfgs[0].Supervisor, cfgs[1].Supervisor)
+	assert.NotSame(t, supervisor, cfgs[0].Supervisor)
+	assert.Equal(t, []string{"ignored"}, p.cfg.Pool.Command)
+}
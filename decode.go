@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingDeflate  string = "deflate"
+	encodingBrotli   string = "br"
+	encodingIdentity string = "identity"
+)
+
+// decodeBody decodes the data compressed with the provided content encoding (gzip, deflate, br or identity),
+// used for the request bodies and the compressed event payloads.
+// A 413 statusError is returned when the decoded data exceeds the limit (0 - unlimited)
+func decodeBody(encoding string, data []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", encodingIdentity:
+		return data, nil
+	case encodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = gr.Close()
+		}()
+
+		r = gr
+	case encodingDeflate:
+		// deflate is zlib wrapped per RFC 9110, but raw deflate is also seen in the wild
+		zr, err := zlibOrFlate(data)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = zr.Close()
+		}()
+
+		r = zr
+	case encodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	default:
+		return nil, newStatusError(http.StatusUnsupportedMediaType, "unsupported content encoding: "+encoding)
+	}
+
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(out)) > limit {
+		return nil, newStatusError(http.StatusRequestEntityTooLarge, "body is too large")
+	}
+
+	return out, nil
+}
+
+// zlibOrFlate returns the zlib reader when the data starts with the zlib header, raw deflate reader otherwise
+func zlibOrFlate(data []byte) (io.ReadCloser, error) {
+	if len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0 {
+		return zlib.NewReader(bytes.NewReader(data))
+	}
+
+	return flate.NewReader(bytes.NewReader(data)), nil
+}
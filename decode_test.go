@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compressBody encodes the data with the provided content encoding
+func compressBody(t testing.TB, encoding string, data []byte) []byte {
+	buf := new(bytes.Buffer)
+
+	var w io.WriteCloser
+	switch encoding {
+	case encodingGzip:
+		w = gzip.NewWriter(buf)
+	case encodingDeflate:
+		w = zlib.NewWriter(buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	case encodingBrotli:
+		w = brotli.NewWriter(buf)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	form := []byte("name=test&tags=a%2Cb")
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+	}{
+		{name: "gzip", encoding: "gzip", data: compressBody(t, encodingGzip, form)},
+		{name: "deflate zlib", encoding: "deflate", data: compressBody(t, encodingDeflate, form)},
+		{name: "deflate raw", encoding: "deflate", data: compressBody(t, "raw-deflate", form)},
+		{name: "brotli", encoding: "br", data: compressBody(t, encodingBrotli, form)},
+		{name: "case insensitive", encoding: " GZIP ", data: compressBody(t, encodingGzip, form)},
+		{name: "identity", encoding: "identity", data: form},
+		{name: "empty", encoding: "", data: form},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := decodeBody(tt.encoding, tt.data, 0)
+			require.NoError(t, err)
+			assert.Equal(t, form, out)
+		})
+	}
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 100)
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+		limit    int64
+		status   int
+	}{
+		{name: "unsupported", encoding: "compress", data: data, status: http.StatusUnsupportedMediaType},
+		{name: "over the limit", encoding: "gzip", data: compressBody(t, encodingGzip, data), limit: 99, status: http.StatusRequestEntityTooLarge},
+		{name: "malformed", encoding: "gzip", data: data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeBody(tt.encoding, tt.data, tt.limit)
+			require.Error(t, err)
+
+			var se *statusError
+			if tt.status == 0 {
+				assert.False(t, errors.As(err, &se))
+				return
+			}
+
+			require.ErrorAs(t, err, &se)
+			assert.Equal(t, tt.status, se.status)
+		})
+	}
+
+	out, err := decodeBody("gzip", compressBody(t, encodingGzip, data), 100)
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+}
+
+func TestDecompressRequest(t *testing.T) {
+	form := "name=test&tags=a%2Cb"
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{name: "deflate", encoding: "deflate", body: compressBody(t, encodingDeflate, []byte(form)), status: http.StatusOK},
+		{name: "brotli", encoding: "br", body: compressBody(t, encodingBrotli, []byte(form)), status: http.StatusOK},
+		{name: "gzip", encoding: "gzip", body: compressBody(t, encodingGzip, []byte(form)), status: http.StatusOK},
+		{name: "malformed", encoding: "br", body: []byte("not brotli"), status: http.StatusBadRequest},
+		{name: "unsupported", encoding: "compress", body: []byte(form), status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{DecompressRequest: true}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/users")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Headers["content-type"] = "application/x-www-form-urlencoded"
+			request.Headers["content-encoding"] = tt.encoding
+			request.Body = base64.StdEncoding.EncodeToString(tt.body)
+			request.IsBase64Encoded = true
+
+			rsp := serve(t, p, request)
+			require.Equal(t, tt.status, rsp.StatusCode)
+
+			if tt.status != http.StatusOK {
+				assert.Empty(t, requests)
+				return
+			}
+
+			require.Len(t, requests, 1)
+			body, err := decodeBase64(requests[0].Body)
+			require.NoError(t, err)
+			assert.Equal(t, form, string(body))
+			assert.Empty(t, getHeader(requests[0].Headers, "content-encoding"))
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// forwarded_host modes, any other value is used as the host
+const (
+	// the incoming Host header, the API Gateway domain when absent
+	forwardedHostAuto string = "auto"
+	// the API Gateway domain
+	forwardedHostDomain string = "domain"
+)
+
+// setForwardedHost sets the X-Forwarded-Host header according to the forwarded_host mode. In the auto mode
+// the header sent by the client (e.g. by CloudFront) is kept, the other modes replace it
+func (p *Plugin) setForwardedHost(request *events.APIGatewayV2HTTPRequest) {
+	var host string
+	switch p.cfg.ForwardedHost {
+	case "":
+		return
+	case forwardedHostAuto:
+		if getHeader(request.Headers, "x-forwarded-host") != "" {
+			return
+		}
+
+		host = getHeader(request.Headers, "host")
+		if host == "" {
+			host = request.RequestContext.DomainName
+		}
+	case forwardedHostDomain:
+		host = request.RequestContext.DomainName
+	default:
+		host = p.cfg.ForwardedHost
+	}
+
+	if host == "" {
+		return
+	}
+
+	setHeader(request.Headers, "x-forwarded-host", host)
+}
+
+// setForwarded sets the enabled forwarding headers: X-Forwarded-For (the source ip), X-Forwarded-Proto (API Gateway
+// only serves https) and Forwarded (RFC 7239, built from the same values). The source ip and the Forwarded element
+// are appended to the client values, so the proxy chain is kept and the last entry is the one API Gateway saw
+func (p *Plugin) setForwarded(request *events.APIGatewayV2HTTPRequest) {
+	fh := &p.cfg.ForwardedHeaders
+	sourceIP := request.RequestContext.HTTP.SourceIP
+
+	if *fh.For && sourceIP != "" {
+		setHeader(request.Headers, "x-forwarded-for", appendForwardedFor(getHeader(request.Headers, "x-forwarded-for"), sourceIP))
+	}
+
+	if *fh.Proto {
+		setHeader(request.Headers, "x-forwarded-proto", "https")
+	}
+
+	if !*fh.Forwarded {
+		return
+	}
+
+	pairs := make([]string, 0, 3)
+	if sourceIP != "" {
+		// the IPv6 addresses must be quoted and bracketed
+		if ip := net.ParseIP(sourceIP); ip != nil && ip.To4() == nil {
+			pairs = append(pairs, `for="[`+sourceIP+`]"`)
+		} else {
+			pairs = append(pairs, "for="+sourceIP)
+		}
+	}
+
+	// the client X-Forwarded-Host is only used when forwarded_host is configured
+	var host string
+	if p.cfg.ForwardedHost != "" {
+		host = getHeader(request.Headers, "x-forwarded-host")
+	}
+	if host == "" {
+		host = getHeader(request.Headers, "host")
+	}
+
+	if host != "" {
+		pairs = append(pairs, "host="+quoteString(host))
+	}
+
+	pairs = append(pairs, "proto=https")
+
+	element := strings.Join(pairs, ";")
+	if forwarded := getHeader(request.Headers, "forwarded"); forwarded != "" {
+		element = forwarded + ", " + element
+	}
+
+	setHeader(request.Headers, "forwarded", element)
+}
+
+// appendForwardedFor appends the ip to the X-Forwarded-For chain, unless it is already the last entry
+// (API Gateway may add the source ip itself)
+func appendForwardedFor(chain, ip string) string {
+	if chain == "" {
+		return ip
+	}
+
+	if i := strings.LastIndexByte(chain, ','); strings.TrimSpace(chain[i+1:]) == ip {
+		return chain
+	}
+
+	return chain + ", " + ip
+}
+
+// quoteString returns the RFC 9110 quoted-string: the quotes and the backslashes are escaped,
+// the control characters (not allowed even when escaped) are dropped
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 && c != '\t', c == 0x7f:
+			// dropped
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+
+	return sb.String()
+}
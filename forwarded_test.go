@@ -0,0 +1,260 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "disabled", headers: map[string]string{"host": "origin.example.com"}, want: ""},
+		{name: "disabled keeps the client value", headers: map[string]string{"x-forwarded-host": "cdn.example.com"}, want: "cdn.example.com"},
+		{name: "auto host header", mode: "auto", headers: map[string]string{"host": "origin.example.com"}, want: "origin.example.com"},
+		{name: "auto domain", mode: "auto", headers: map[string]string{}, want: "abc123.execute-api.us-east-1.amazonaws.com"},
+		{
+			name:    "auto keeps the cdn value",
+			mode:    "auto",
+			headers: map[string]string{"host": "origin.example.com", "X-Forwarded-Host": "www.example.com"},
+			want:    "www.example.com",
+		},
+		{
+			name:    "domain",
+			mode:    "domain",
+			headers: map[string]string{"host": "origin.example.com", "x-forwarded-host": "www.example.com"},
+			want:    "abc123.execute-api.us-east-1.amazonaws.com",
+		},
+		{
+			name:    "literal",
+			mode:    "api.example.com",
+			headers: map[string]string{"host": "origin.example.com", "X-Forwarded-Host": "www.example.com"},
+			want:    "api.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{ForwardedHost: tt.mode}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/users")
+			request.Headers = tt.headers
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, getHeader(requests[0].Headers, "x-forwarded-host"))
+
+			// a single header reaches the worker regardless of the client header case
+			n := 0
+			for k := range requests[0].Headers {
+				if k == "x-forwarded-host" || k == "X-Forwarded-Host" {
+					n++
+				}
+			}
+			assert.LessOrEqual(t, n, 1)
+		})
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	off := false
+	client := map[string]string{
+		"host":              "example.com",
+		"X-Forwarded-For":   "10.0.0.1",
+		"x-forwarded-proto": "http",
+		"Forwarded":         "for=10.0.0.1;proto=http",
+	}
+
+	tests := []struct {
+		name     string
+		cfg      ForwardedHeadersConfig
+		headers  map[string]string
+		sourceIP string
+		want     map[string]string
+	}{
+		{
+			name:     "all enabled by default",
+			headers:  client,
+			sourceIP: "203.0.113.7",
+			want: map[string]string{
+				"x-forwarded-for":   "10.0.0.1, 203.0.113.7",
+				"x-forwarded-proto": "https",
+				"forwarded":         `for=10.0.0.1;proto=http, for=203.0.113.7;host="example.com";proto=https`,
+			},
+		},
+		{
+			name:     "without the client values",
+			headers:  map[string]string{"host": "example.com"},
+			sourceIP: "203.0.113.7",
+			want:     map[string]string{"x-forwarded-for": "203.0.113.7", "x-forwarded-proto": "https", "forwarded": `for=203.0.113.7;host="example.com";proto=https`},
+		},
+		{
+			name:     "x-forwarded-for disabled",
+			cfg:      ForwardedHeadersConfig{For: &off},
+			headers:  client,
+			sourceIP: "203.0.113.7",
+			want: map[string]string{
+				"x-forwarded-for":   "10.0.0.1",
+				"x-forwarded-proto": "https",
+				"forwarded":         `for=10.0.0.1;proto=http, for=203.0.113.7;host="example.com";proto=https`,
+			},
+		},
+		{
+			name:     "x-forwarded-proto disabled",
+			cfg:      ForwardedHeadersConfig{Proto: &off},
+			headers:  client,
+			sourceIP: "203.0.113.7",
+			want: map[string]string{
+				"x-forwarded-for":   "10.0.0.1, 203.0.113.7",
+				"x-forwarded-proto": "http",
+				"forwarded":         `for=10.0.0.1;proto=http, for=203.0.113.7;host="example.com";proto=https`,
+			},
+		},
+		{
+			name:     "forwarded disabled",
+			cfg:      ForwardedHeadersConfig{Forwarded: &off},
+			headers:  client,
+			sourceIP: "203.0.113.7",
+			want:     map[string]string{"x-forwarded-for": "10.0.0.1, 203.0.113.7", "x-forwarded-proto": "https", "forwarded": "for=10.0.0.1;proto=http"},
+		},
+		{
+			name:     "all disabled",
+			cfg:      ForwardedHeadersConfig{For: &off, Proto: &off, Forwarded: &off},
+			headers:  client,
+			sourceIP: "203.0.113.7",
+			want:     map[string]string{"x-forwarded-for": "10.0.0.1", "x-forwarded-proto": "http", "forwarded": "for=10.0.0.1;proto=http"},
+		},
+		{
+			name:     "source ip already appended",
+			headers:  map[string]string{"host": "example.com", "x-forwarded-for": "10.0.0.1, 203.0.113.7"},
+			sourceIP: "203.0.113.7",
+			want:     map[string]string{"x-forwarded-for": "10.0.0.1, 203.0.113.7"},
+		},
+		{
+			name:     "without the source ip",
+			headers:  client,
+			sourceIP: "",
+			want:     map[string]string{"x-forwarded-for": "10.0.0.1", "forwarded": `for=10.0.0.1;proto=http, host="example.com";proto=https`},
+		},
+		{
+			name:     "forwarded ipv6",
+			headers:  map[string]string{"host": "example.com"},
+			sourceIP: "2001:db8::1",
+			want:     map[string]string{"x-forwarded-for": "2001:db8::1", "forwarded": `for="[2001:db8::1]";host="example.com";proto=https`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{ForwardedHeaders: tt.cfg}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/users")
+			request.RequestContext.HTTP.SourceIP = tt.sourceIP
+			request.Headers = make(map[string]string, len(tt.headers))
+			for k, v := range tt.headers {
+				request.Headers[k] = v
+			}
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			for name, want := range tt.want {
+				assert.Equal(t, want, getHeader(requests[0].Headers, name), name)
+			}
+		})
+	}
+}
+
+func TestAppendForwardedFor(t *testing.T) {
+	tests := []struct {
+		chain string
+		want  string
+	}{
+		{chain: "", want: "203.0.113.7"},
+		{chain: "10.0.0.1", want: "10.0.0.1, 203.0.113.7"},
+		{chain: "10.0.0.1, 10.0.0.2", want: "10.0.0.1, 10.0.0.2, 203.0.113.7"},
+		{chain: "10.0.0.1,203.0.113.7", want: "10.0.0.1,203.0.113.7"},
+		{chain: "203.0.113.7", want: "203.0.113.7"},
+		// only the last entry counts, the client may send any value first
+		{chain: "203.0.113.7, 10.0.0.1", want: "203.0.113.7, 10.0.0.1, 203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, appendForwardedFor(tt.chain, "203.0.113.7"), tt.chain)
+	}
+}
+
+func TestForwardedHostParameter(t *testing.T) {
+	tests := []struct {
+		name          string
+		forwardedHost string
+		headers       map[string]string
+		want          string
+	}{
+		{
+			name:    "client x-forwarded-host ignored",
+			headers: map[string]string{"host": "example.com", "x-forwarded-host": "evil.example.com"},
+			want:    `for=203.0.113.7;host="example.com";proto=https`,
+		},
+		{
+			name:          "configured forwarded host",
+			forwardedHost: "api.example.com",
+			headers:       map[string]string{"host": "example.com", "x-forwarded-host": "evil.example.com"},
+			want:          `for=203.0.113.7;host="api.example.com";proto=https`,
+		},
+		{
+			name:    "escaped host",
+			headers: map[string]string{"host": `a"b\c`},
+			want:    `for=203.0.113.7;host="a\"b\\c";proto=https`,
+		},
+		{
+			name:    "no host",
+			headers: map[string]string{},
+			want:    `for=203.0.113.7;proto=https`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{
+				ForwardedHost: tt.forwardedHost,
+			}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/users")
+			request.Headers = tt.headers
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, getHeader(requests[0].Headers, "forwarded"))
+		})
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "example.com", want: `"example.com"`},
+		{in: "example.com:8443", want: `"example.com:8443"`},
+		{in: `a"b`, want: `"a\"b"`},
+		{in: `a\b`, want: `"a\\b"`},
+		{in: "a\r\nb\x7f\tc", want: "\"ab\tc\""},
+		{in: "", want: `""`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, quoteString(tt.in), tt.in)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// EventHandler is implemented by the endure plugins handling the custom event types (the lambda.event_type option).
+// The plugins registered in main.go are collected by the lambda plugin (see Collects), built-in types can be overridden
+type EventHandler interface {
+	// EventType returns the lambda.event_type value selecting the handler
+	EventType() string
+	// Handler returns the lambda handler satisfying the lambda.Start rules, e.g. func(context.Context, events.ActiveMQEvent) error.
+	// The events are sent to the worker with invoke
+	Handler(invoke InvokeFunc) any
+}
+
+// InvokeFunc sends the event to the worker with the payload context attributes (the request id is added)
+// and decodes the worker response into out, nothing is decoded when out is nil.
+// NoFreeWorkers error is returned when the max_concurrency limit is reached
+type InvokeFunc func(ctx context.Context, event any, attrs map[string]string, out any) error
+
+// addEventHandler registers the collected event handler plugin
+func (p *Plugin) addEventHandler(h EventHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.handlers == nil {
+		p.handlers = make(map[string]any, 1)
+	}
+
+	p.handlers[strings.ToLower(h.EventType())] = h.Handler(p.invokeWorker)
+}
+
+// invokeWorker is the InvokeFunc passed to the custom event handlers
+func (p *Plugin) invokeWorker(ctx context.Context, event any, attrs map[string]string, out any) error {
+	const op = errors.Op("lambda_invoke_worker")
+
+	if !p.acquire() {
+		return errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+	}
+	defer p.release()
+
+	a := p.getAttrs()
+	defer p.putAttrs(a)
+
+	for k, v := range attrs {
+		a[k] = v
+	}
+	a[attrRequestID] = requestID(ctx)
+
+	err := p.invoke(ctx, p.wrkPool, event, a, out)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// registerBuiltinHandlers adds the built-in event handlers which are not overridden, p.mu should be held
+func (p *Plugin) registerBuiltinHandlers() {
+	builtin := map[string]any{
+		eventTypeHTTP:           p.handler(),
+		eventTypeRaw:            p.rawHandler(),
+		eventTypeCognito:        p.cognitoHandler(),
+		eventTypeWebsocket:      p.websocketHandler(),
+		eventTypeCloudwatchLogs: p.cloudwatchLogsHandler(),
+		eventTypeALB:            p.albHandler(),
+		eventTypeKafka:          p.kafkaHandler(),
+		eventTypeSQS:            p.sqsHandler(),
+	}
+
+	if p.handlers == nil {
+		p.handlers = make(map[string]any, len(builtin))
+	}
+
+	for k, v := range builtin {
+		if _, ok := p.handlers[k]; !ok {
+			p.handlers[k] = v
+		}
+	}
+}
+
+// handlerFor returns the handler registered for the event type, p.mu should be held
+func (p *Plugin) handlerFor(eventType string) (any, error) {
+	h, ok := p.handlers[eventType]
+	if !ok {
+		types := make([]string, 0, len(p.handlers))
+		for k := range p.handlers {
+			types = append(types, k)
+		}
+		slices.Sort(types)
+
+		return nil, errors.Errorf("unknown event type: %s, supported types: %s", eventType, strings.Join(types, ", "))
+	}
+
+	return h, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// activeMQ handles the ActiveMQ events
+type activeMQ struct{}
+
+func (*activeMQ) EventType() string {
+	return "MQ"
+}
+
+func (*activeMQ) Handler(invoke InvokeFunc) any {
+	return func(ctx context.Context, event events.ActiveMQEvent) (int, error) {
+		var processed int
+		err := invoke(ctx, event, map[string]string{"event_source": event.EventSource}, &processed)
+		return processed, err
+	}
+}
+
+// httpOverride replaces the built-in http handler
+type httpOverride struct{}
+
+func (*httpOverride) EventType() string {
+	return eventTypeHTTP
+}
+
+func (*httpOverride) Handler(InvokeFunc) any {
+	return func(context.Context, json.RawMessage) (string, error) {
+		return "overridden", nil
+	}
+}
+
+func TestCustomEventType(t *testing.T) {
+	var attrs map[string]string
+	var received events.ActiveMQEvent
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: "mq"}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		require.NoError(t, p.decode(pld.Context, &attrs))
+		require.NoError(t, json.Unmarshal(pld.Body, &received))
+
+		return &payload.Payload{Body: []byte(`2`)}, nil
+	}, &activeMQ{})
+
+	event := `{"eventSource":"aws:mq","messages":[{"messageID":"1","data":"aGVsbG8="},{"messageID":"2","data":"d29ybGQ="}]}`
+	out, err := lambda.NewHandler(p.eventHandler).Invoke(testContext(), []byte(event))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(out))
+
+	assert.Equal(t, "aws:mq", attrs["event_source"])
+	assert.Equal(t, testRequestID, attrs[attrRequestID])
+	require.Len(t, received.Messages, 2)
+	assert.Equal(t, "1", received.Messages[0].MessageID)
+}
+
+func TestCustomEventTypeOverridesBuiltin(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, nil, &httpOverride{})
+
+	out, err := lambda.NewHandler(p.eventHandler).Invoke(testContext(), []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, `"overridden"`, string(out))
+}
+
+func TestCustomEventTypeConcurrencyLimit(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: "mq", MaxConcurrency: 1}, respond(1, nil), &activeMQ{})
+
+	require.True(t, p.acquire())
+	defer p.release()
+
+	err := p.invokeWorker(testContext(), events.ActiveMQEvent{}, nil, nil)
+	assert.True(t, errors.Is(errors.NoFreeWorkers, err))
+}
+
+func TestUnknownEventType(t *testing.T) {
+	p := &Plugin{}
+	setTestPools(t, p, nil)
+
+	cfg := &Config{EventType: "mq"}
+	require.NoError(t, p.Init(&testConfigurer{cfg: cfg}, nil, &testLogger{log: zap.NewNop()}))
+
+	// no plugin handles the mq events
+	collect(p, &httpOverride{})
+
+	err := <-p.Serve()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown event type: mq, supported types: alb, cloudwatch_logs, cognito, http, kafka, raw, sqs, websocket")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// getHeader returns the value of the header with the provided name, the lookup is case-insensitive.
+// Safe to use with nil headers
+func getHeader(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// setHeader sets the header replacing all the existing values with the same name in any case.
+// The headers map must not be nil
+func setHeader(headers map[string]string, name, value string) {
+	delHeader(headers, name)
+	headers[name] = value
+}
+
+// delHeader removes the header with the provided name in any case
+func delHeader(headers map[string]string, name string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			delete(headers, k)
+		}
+	}
+}
+
+// hasToken reports whether the comma-separated header value contains the token, parameters (;q=) are ignored
+func hasToken(value, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if i := strings.IndexByte(t, ';'); i != -1 {
+			t = t[:i]
+		}
+
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalHeaders rewrites the header names to the canonical form (content-type -> Content-Type).
+// When the same header is present in different cases, the value under the canonical name wins,
+// otherwise the value under the lexicographically smallest name is used
+func canonicalHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+
+	out := make(map[string]string, len(headers))
+	// canonical name -> original name of the selected value
+	from := make(map[string]string, len(headers))
+
+	for k, v := range headers {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		if prev, ok := from[ck]; ok && (prev == ck || (k != ck && prev < k)) {
+			continue
+		}
+
+		from[ck] = k
+		out[ck] = v
+	}
+
+	return out
+}
+
+// mergeHeaders combines the single and multi-value headers under the canonical names, the newline-joined
+// values (e.g. several Set-Cookie) are split. Values repeated in both maps are kept once
+func mergeHeaders(headers map[string]string, multi map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(headers)+len(multi))
+
+	add := func(k, v string) {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		for _, s := range strings.Split(v, "\n") {
+			if s = strings.TrimSpace(s); s != "" && !slices.Contains(out[ck], s) {
+				out[ck] = append(out[ck], s)
+			}
+		}
+	}
+
+	for k, v := range multi {
+		for i := 0; i < len(v); i++ {
+			add(k, v[i])
+		}
+	}
+
+	for k, v := range headers {
+		add(k, v)
+	}
+
+	return out
+}
+
+// removeHopByHop removes the hop-by-hop headers (RFC 9110) and the headers listed in the Connection header
+func removeHopByHop(headers map[string]string) {
+	for _, name := range strings.Split(getHeader(headers, "connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			delHeader(headers, name)
+		}
+	}
+
+	for _, name := range []string{"connection", "keep-alive", "proxy-authenticate", "proxy-authorization", "proxy-connection", "te", "trailer", "transfer-encoding", "upgrade"} {
+		delHeader(headers, name)
+	}
+}
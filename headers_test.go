@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string
+	}{
+		{name: "nil", headers: nil, want: nil},
+		{name: "canonicalized", headers: map[string]string{"content-type": "text/plain", "x-request-id": "1"}, want: map[string]string{"Content-Type": "text/plain", "X-Request-Id": "1"}},
+		{name: "canonical name wins", headers: map[string]string{"content-type": "a", "Content-Type": "b", "CONTENT-TYPE": "c"}, want: map[string]string{"Content-Type": "b"}},
+		{name: "smallest name wins", headers: map[string]string{"content-type": "a", "CONTENT-TYPE": "c", "Content-type": "b"}, want: map[string]string{"Content-Type": "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the precedence doesn't depend on the map iteration order
+			for i := 0; i < 10; i++ {
+				assert.Equal(t, tt.want, canonicalHeaders(tt.headers))
+			}
+		})
+	}
+}
+
+func TestResponseHeadersCanonicalized(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"content-type": "text/plain", "Content-Type": "application/json", "cache-control": "no-cache"},
+		Body:       "{}",
+	}, nil))
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, map[string]string{"Content-Type": "application/json", "Cache-Control": "no-cache"}, rsp.Headers)
+}
+
+func TestHeaderHelpers(t *testing.T) {
+	headers := map[string]string{"Content-Type": "text/plain", "x-custom": "1", "X-Custom": "2"}
+
+	assert.Equal(t, "text/plain", getHeader(headers, "content-type"))
+	assert.Equal(t, "", getHeader(nil, "content-type"))
+
+	setHeader(headers, "X-CUSTOM", "3")
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain", "X-CUSTOM": "3"}, headers)
+
+	delHeader(headers, "x-custom")
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain"}, headers)
+
+	assert.True(t, hasToken("Origin, Accept-Encoding;q=1", "accept-encoding"))
+	assert.False(t, hasToken("Origin, Accept-Encodings", "accept-encoding"))
+}
+
+func BenchmarkCanonicalHeaders(b *testing.B) {
+	headers := map[string]string{
+		"content-type":   "application/json",
+		"cache-control":  "no-cache",
+		"x-request-id":   testRequestID,
+		"Content-Length": "42",
+		"set-cookie":     "a=1",
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = canonicalHeaders(headers)
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		multi   map[string][]string
+		want    map[string][]string
+	}{
+		{name: "empty", want: map[string][]string{}},
+		{name: "single", headers: map[string]string{"content-type": "text/plain"}, want: map[string][]string{"Content-Type": {"text/plain"}}},
+		{name: "newline-joined", headers: map[string]string{"Set-Cookie": "a=1\nb=2"}, want: map[string][]string{"Set-Cookie": {"a=1", "b=2"}}},
+		{name: "multi-value", multi: map[string][]string{"set-cookie": {"a=1", "b=2"}}, want: map[string][]string{"Set-Cookie": {"a=1", "b=2"}}},
+		{
+			name:    "both maps",
+			headers: map[string]string{"Set-Cookie": "a=1", "X-Id": "1"},
+			multi:   map[string][]string{"Set-Cookie": {"a=1", "b=2"}},
+			want:    map[string][]string{"Set-Cookie": {"a=1", "b=2"}, "X-Id": {"1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergeHeaders(tt.headers, tt.multi))
+		})
+	}
+}
+
+func TestRemoveHopByHop(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "standard",
+			headers: map[string]string{
+				"Connection":        "keep-alive",
+				"keep-alive":        "timeout=5",
+				"TE":                "trailers",
+				"Trailer":           "Expires",
+				"transfer-encoding": "chunked",
+				"Upgrade":           "websocket",
+				"proxy-connection":  "keep-alive",
+				"accept":            "text/html",
+			},
+			want: map[string]string{"accept": "text/html"},
+		},
+		{
+			name:    "listed in connection",
+			headers: map[string]string{"connection": "close, X-Internal-Token , ", "x-internal-token": "secret", "x-request-id": "1"},
+			want:    map[string]string{"x-request-id": "1"},
+		},
+		{
+			name:    "proxy credentials",
+			headers: map[string]string{"Proxy-Authorization": "Basic abc", "authorization": "Bearer token"},
+			want:    map[string]string{"authorization": "Bearer token"},
+		},
+		{
+			name:    "none",
+			headers: map[string]string{"accept": "*/*"},
+			want:    map[string]string{"accept": "*/*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeHopByHop(tt.headers)
+			assert.Equal(t, tt.want, tt.headers)
+		})
+	}
+}
+
+func TestKeepHopByHopHeaders(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		var requests []events.APIGatewayV2HTTPRequest
+		p := &Plugin{}
+		newTestPlugin(t, p, &Config{KeepHopByHopHeaders: keep}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+		request := testRequest("/chat")
+		request.Headers["connection"] = "upgrade"
+		request.Headers["upgrade"] = "websocket"
+
+		serve(t, p, request)
+		require.Len(t, requests, 1)
+		assert.Equal(t, keep, getHeader(requests[0].Headers, "upgrade") == "websocket")
+		assert.Equal(t, keep, getHeader(requests[0].Headers, "connection") == "upgrade")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+)
+
+type healthStatus struct {
+	// Workers is the number of workers in the default pool
+	Workers int `json:"workers"`
+	// build information
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// healthResponse reports the plugin status without sending the request to the worker
+func (p *Plugin) healthResponse() events.APIGatewayV2HTTPResponse {
+	st := &healthStatus{
+		Workers:   len(p.wrkPool.Workers()),
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+	}
+
+	body, err := json.Marshal(st)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: http.StatusInternalServerError}
+	}
+
+	status := http.StatusOK
+	if st.Workers == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
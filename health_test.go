@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/roadrunner-server/pool/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthPath(t *testing.T) {
+	var calls atomic.Int32
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{HealthPath: "/_rr_health", Pool: &pool.Config{NumWorkers: 3}}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		calls.Add(1)
+		return &payload.Payload{Body: []byte(`{"statusCode":200}`)}, nil
+	})
+
+	rsp := serve(t, p, testRequest("/_rr_health"))
+	assert.Equal(t, 200, rsp.StatusCode)
+	assert.Equal(t, "application/json", rsp.Headers["Content-Type"])
+	assert.Zero(t, calls.Load())
+
+	var st healthStatus
+	require.NoError(t, json.Unmarshal([]byte(rsp.Body), &st))
+	assert.Equal(t, 3, st.Workers)
+	assert.Equal(t, version, st.Version)
+
+	// other paths reach the worker
+	serve(t, p, testRequest("/_rr_health/other"))
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotency remembers the processed keys for the ttl. The keys live in the container memory,
+// so the duplicates delivered to the other (or a new) container are not detected
+type idempotency struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// key -> expiration time
+	keys map[string]time.Time
+	// the expired keys are removed at most once per ttl
+	nextSweep time.Time
+}
+
+func newIdempotency(ttl time.Duration) *idempotency {
+	return &idempotency{
+		ttl:  ttl,
+		keys: make(map[string]time.Time, 100),
+	}
+}
+
+// seen reports whether the key was processed within the ttl
+func (i *idempotency) seen(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	exp, ok := i.keys[key]
+	return ok && time.Now().Before(exp)
+}
+
+// add marks the key as processed
+func (i *idempotency) add(key string) {
+	now := time.Now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if now.After(i.nextSweep) {
+		for k, exp := range i.keys {
+			if now.After(exp) {
+				delete(i.keys, k)
+			}
+		}
+
+		i.nextSweep = now.Add(i.ttl)
+	}
+
+	i.keys[key] = now.Add(i.ttl)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RequestInterceptor is invoked for the http events before the request is sent to the worker.
+// The interceptors are the endure plugins registered in main.go, they are collected by the plugin (see Collects).
+// The request can be mutated, returning a non-nil response short-circuits the request (the worker is not called),
+// returning an error ends the request with 500 (or the status of the statusError)
+type RequestInterceptor interface {
+	InterceptRequest(ctx context.Context, request *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error)
+}
+
+// ResponseInterceptor is invoked for the http events after the worker response is prepared, the response can be mutated.
+// Returning an error replaces the response with 500 (or the status of the statusError)
+type ResponseInterceptor interface {
+	InterceptResponse(ctx context.Context, request *events.APIGatewayV2HTTPRequest, response *events.APIGatewayV2HTTPResponse) error
+}
+
+// interceptRequest runs the request interceptors until the first one returning a response or an error
+func (p *Plugin) interceptRequest(ctx context.Context, request *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	for i := 0; i < len(p.reqInterceptors); i++ {
+		rsp, err := p.reqInterceptors[i].InterceptRequest(ctx, request)
+		if err != nil || rsp != nil {
+			return rsp, err
+		}
+	}
+
+	return nil, nil
+}
+
+// interceptResponse runs the response interceptors until the first error
+func (p *Plugin) interceptResponse(ctx context.Context, request *events.APIGatewayV2HTTPRequest, response *events.APIGatewayV2HTTPResponse) error {
+	for i := 0; i < len(p.rspInterceptors); i++ {
+		err := p.rspInterceptors[i].InterceptResponse(ctx, request, response)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiKey denies the requests without the API key, the worker is not called
+type apiKey struct{}
+
+func (*apiKey) InterceptRequest(_ context.Context, r *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	if getHeader(r.Headers, "x-api-key") == "" {
+		return &events.APIGatewayV2HTTPResponse{StatusCode: http.StatusUnauthorized, Body: "missing API key"}, nil
+	}
+
+	// the worker doesn't need the key
+	delHeader(r.Headers, "x-api-key")
+
+	return nil, nil
+}
+
+// securityHeaders rewrites the worker response
+type securityHeaders struct{}
+
+func (*securityHeaders) InterceptResponse(_ context.Context, _ *events.APIGatewayV2HTTPRequest, r *events.APIGatewayV2HTTPResponse) error {
+	if r.Headers == nil {
+		r.Headers = make(map[string]string, 1)
+	}
+
+	r.Headers["X-Frame-Options"] = "DENY"
+	delete(r.Headers, "Server")
+	r.Body = "[redacted]"
+
+	return nil
+}
+
+// failing rejects every response
+type failing struct{}
+
+func (*failing) InterceptResponse(context.Context, *events.APIGatewayV2HTTPRequest, *events.APIGatewayV2HTTPResponse) error {
+	return newStatusError(http.StatusForbidden, "forbidden")
+}
+
+func TestCollectsInterceptors(t *testing.T) {
+	p := &Plugin{}
+	collect(p, &apiKey{}, &securityHeaders{}, &failing{}, struct{}{})
+
+	require.Len(t, p.reqInterceptors, 1)
+	require.Len(t, p.rspInterceptors, 2)
+	assert.IsType(t, &securityHeaders{}, p.rspInterceptors[0])
+	assert.IsType(t, &failing{}, p.rspInterceptors[1])
+}
+
+func TestRequestInterceptorShortCircuit(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests), &apiKey{})
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	assert.Equal(t, "missing API key", rsp.Body)
+	assert.Empty(t, requests)
+
+	request := testRequest("/users")
+	request.Headers["x-api-key"] = "secret"
+
+	rsp = serve(t, p, request)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Len(t, requests, 1)
+	assert.Empty(t, getHeader(requests[0].Headers, "x-api-key"))
+}
+
+func TestResponseInterceptorRewrite(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"server": "php", "Content-Type": "text/plain"},
+		Body:       "secret",
+	}, nil), &securityHeaders{})
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, map[string]string{"Content-Type": "text/plain", "X-Frame-Options": "DENY"}, rsp.Headers)
+	assert.Equal(t, "[redacted]", rsp.Body)
+}
+
+func TestResponseInterceptorError(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Body: "ok"}, nil), &securityHeaders{}, &failing{})
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+	assert.NotEqual(t, "[redacted]", rsp.Body)
+}
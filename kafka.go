@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	attrTopic     string = "topic"
+	attrPartition string = "partition"
+	attrOffset    string = "offset"
+)
+
+// kafkaRecord is the Kafka record sent to the worker, the key and the value are base64 decoded
+type kafkaRecord struct {
+	Topic         string              `json:"topic"`
+	Partition     int64               `json:"partition"`
+	Offset        int64               `json:"offset"`
+	Timestamp     int64               `json:"timestamp"`
+	TimestampType string              `json:"timestamp_type"`
+	Key           string              `json:"key"`
+	Value         string              `json:"value"`
+	Headers       []map[string]string `json:"headers"`
+}
+
+// kafkaHandler handles the MSK and self-managed Kafka events, the worker is invoked once per record.
+// Records with the malformed base64 key or value are logged and skipped. Worker errors are returned to make lambda retry
+func (p *Plugin) kafkaHandler() func(ctx context.Context, event events.KafkaEvent) error {
+	return func(ctx context.Context, event events.KafkaEvent) error {
+		const op = errors.Op("lambda_kafka_handler")
+
+		if !p.acquire() {
+			return errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+
+		// records are keyed by topic-partition, sorted for the stable processing order
+		keys := make([]string, 0, len(event.Records))
+		for k := range event.Records {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			records := event.Records[k]
+			for i := 0; i < len(records); i++ {
+				record, err := decodeKafkaRecord(&records[i])
+				if err != nil {
+					p.log.Error("failed to decode the kafka record, skipping",
+						zap.String("request_id", requestID(ctx)),
+						zap.String("topic", records[i].Topic),
+						zap.Int64("partition", records[i].Partition),
+						zap.Int64("offset", records[i].Offset),
+						zap.Error(err),
+					)
+					continue
+				}
+
+				attrs[attrRequestID] = requestID(ctx)
+				attrs[attrTopic] = record.Topic
+				attrs[attrPartition] = strconv.FormatInt(record.Partition, 10)
+				attrs[attrOffset] = strconv.FormatInt(record.Offset, 10)
+
+				err = p.invoke(ctx, p.wrkPool, record, attrs, nil)
+				if err != nil {
+					return errors.E(op, err)
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// decodeKafkaRecord decodes the base64 key and value of the record
+func decodeKafkaRecord(r *events.KafkaRecord) (*kafkaRecord, error) {
+	key, err := decodeBase64(r.Key)
+	if err != nil {
+		return nil, errors.Errorf("invalid base64 key: %v", err)
+	}
+
+	value, err := decodeBase64(r.Value)
+	if err != nil {
+		return nil, errors.Errorf("invalid base64 value: %v", err)
+	}
+
+	headers := make([]map[string]string, 0, len(r.Headers))
+	for i := 0; i < len(r.Headers); i++ {
+		h := make(map[string]string, len(r.Headers[i]))
+		for k, v := range r.Headers[i] {
+			h[k] = string(v)
+		}
+		headers = append(headers, h)
+	}
+
+	return &kafkaRecord{
+		Topic:         r.Topic,
+		Partition:     r.Partition,
+		Offset:        r.Offset,
+		Timestamp:     r.Timestamp.UnixMilli(),
+		TimestampType: r.TimestampType,
+		Key:           string(key),
+		Value:         string(value),
+		Headers:       headers,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kafkaEvent = `{
+	"eventSource": "aws:kafka",
+	"records": {
+		"orders-1": [
+			{"topic": "orders", "partition": 1, "offset": 7, "timestamp": 1700000000000, "timestampType": "CREATE_TIME",
+			 "key": "a2V5LTI=", "value": "eyJpZCI6Mn0=", "headers": [{"source": [97, 112, 112]}]}
+		],
+		"orders-0": [
+			{"topic": "orders", "partition": 0, "offset": 41, "timestamp": 1700000000000, "timestampType": "CREATE_TIME",
+			 "key": "a2V5LTE=", "value": "eyJpZCI6MX0=", "headers": []},
+			{"topic": "orders", "partition": 0, "offset": 42, "timestamp": 1700000000000, "timestampType": "CREATE_TIME",
+			 "key": "a2V5LTE=", "value": "%%%", "headers": []}
+		]
+	}
+}`
+
+func TestKafkaRecordsDecoded(t *testing.T) {
+	var records []kafkaRecord
+	var attrs []map[string]string
+
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{EventType: eventTypeKafka}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		var record kafkaRecord
+		require.NoError(t, json.Unmarshal(pld.Body, &record))
+		records = append(records, record)
+
+		var a map[string]string
+		require.NoError(t, p.decode(pld.Context, &a))
+		attrs = append(attrs, a)
+
+		return &payload.Payload{}, nil
+	})
+
+	_, err := lambda.NewHandler(p.kafkaHandler()).Invoke(testContext(), []byte(kafkaEvent))
+	require.NoError(t, err)
+
+	// sorted by topic-partition, the malformed record is skipped
+	require.Len(t, records, 2)
+	assert.Equal(t, kafkaRecord{
+		Topic:         "orders",
+		Offset:        41,
+		Timestamp:     1700000000000,
+		TimestampType: "CREATE_TIME",
+		Key:           "key-1",
+		Value:         `{"id":1}`,
+		Headers:       []map[string]string{},
+	}, records[0])
+	assert.Equal(t, "key-2", records[1].Key)
+	assert.Equal(t, `{"id":2}`, records[1].Value)
+	assert.Equal(t, []map[string]string{{"source": "app"}}, records[1].Headers)
+
+	assert.Equal(t, map[string]string{attrRequestID: testRequestID, attrTopic: "orders", attrPartition: "0", attrOffset: "41"}, attrs[0])
+	assert.Equal(t, "1", attrs[1][attrPartition])
+	assert.Equal(t, "7", attrs[1][attrOffset])
+
+	entries := logs.FilterMessage("failed to decode the kafka record, skipping").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(42), entries[0].ContextMap()["offset"])
+}
+
+func TestKafkaWorkerError(t *testing.T) {
+	calls := 0
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeKafka}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		calls++
+		return nil, errors.Str("worker failed")
+	})
+
+	_, err := lambda.NewHandler(p.kafkaHandler()).Invoke(testContext(), []byte(kafkaEvent))
+	assert.Error(t, err)
+	// the batch is retried, the rest of the records are not processed
+	assert.Equal(t, 1, calls)
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
@@ -16,12 +18,21 @@ import (
 	"github.com/roadrunner-server/server/v5"
 )
 
+const (
+	// envPath overrides the list of directories (separated by the os.PathListSeparator) appended to the PATH,
+	// LAMBDA_TASK_ROOT is used by default
+	envPath string = "RR_LAMBDA_PATH"
+	// envLdLibraryPath overrides the LD_LIBRARY_PATH value
+	envLdLibraryPath string = "RR_LAMBDA_LD_LIBRARY_PATH"
+
+	defaultLdLibraryPath string = "./lib:/lib64:/usr/lib64"
+)
+
 //go:embed .rr.yaml
 var rrYaml []byte
 
 func main() {
-	_ = os.Setenv("PATH", os.Getenv("PATH")+":"+os.Getenv("LAMBDA_TASK_ROOT"))
-	_ = os.Setenv("LD_LIBRARY_PATH", "./lib:/lib64:/usr/lib64")
+	configureEnvironment()
 
 	cont := endure.New(slog.LevelError)
 
@@ -63,10 +74,12 @@ func main() {
 		for {
 			select {
 			case e := <-ch:
+				// the function is restarted by lambda when the process exits
 				err = cont.Stop()
 				if err != nil {
-					log.Println(e.Error.Error())
+					log.Println(err.Error())
 				}
+				log.Fatal(e.Error)
 			case <-sig:
 				err = cont.Stop()
 				if err != nil {
@@ -79,3 +92,34 @@ func main() {
 
 	wg.Wait()
 }
+
+// configureEnvironment prepares PATH and LD_LIBRARY_PATH for the workers, repeated calls don't change the result
+func configureEnvironment() {
+	dirs := []string{os.Getenv("LAMBDA_TASK_ROOT")}
+	if v, ok := os.LookupEnv(envPath); ok {
+		dirs = filepath.SplitList(v)
+	}
+
+	_ = os.Setenv("PATH", appendPath(os.Getenv("PATH"), dirs...))
+
+	ldLibraryPath := defaultLdLibraryPath
+	if v := os.Getenv(envLdLibraryPath); v != "" {
+		ldLibraryPath = v
+	}
+
+	_ = os.Setenv("LD_LIBRARY_PATH", ldLibraryPath)
+}
+
+// appendPath appends the directories to the path list, skipping the empty ones (an empty entry means
+// the current directory) and the ones which are already there
+func appendPath(path string, dirs ...string) string {
+	for i := 0; i < len(dirs); i++ {
+		if dirs[i] == "" || slices.Contains(filepath.SplitList(path), dirs[i]) {
+			continue
+		}
+
+		path += string(os.PathListSeparator) + dirs[i]
+	}
+
+	return path
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendPath(t *testing.T) {
+	sep := string(os.PathListSeparator)
+
+	tests := []struct {
+		name string
+		path string
+		dirs []string
+		want string
+	}{
+		{name: "append", path: "/usr/bin", dirs: []string{"/var/task"}, want: "/usr/bin" + sep + "/var/task"},
+		{name: "already present", path: "/usr/bin" + sep + "/var/task", dirs: []string{"/var/task"}, want: "/usr/bin" + sep + "/var/task"},
+		{name: "empty dir skipped", path: "/usr/bin", dirs: []string{"", "/opt/bin"}, want: "/usr/bin" + sep + "/opt/bin"},
+		{name: "duplicates in dirs", path: "/usr/bin", dirs: []string{"/opt/bin", "/opt/bin"}, want: "/usr/bin" + sep + "/opt/bin"},
+		{name: "nothing to add", path: "/usr/bin", want: "/usr/bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, appendPath(tt.path, tt.dirs...))
+		})
+	}
+}
+
+func TestConfigureEnvironmentDefaults(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("LAMBDA_TASK_ROOT", "/var/task")
+	t.Setenv(envLdLibraryPath, "")
+	// restored by the cleanup
+	t.Setenv(envPath, "")
+	_ = os.Unsetenv(envPath)
+
+	configureEnvironment()
+	// repeated calls don't append again
+	configureEnvironment()
+
+	assert.Equal(t, "/usr/bin"+string(os.PathListSeparator)+"/var/task", os.Getenv("PATH"))
+	assert.Equal(t, defaultLdLibraryPath, os.Getenv("LD_LIBRARY_PATH"))
+}
+
+func TestConfigureEnvironmentOverrides(t *testing.T) {
+	sep := string(os.PathListSeparator)
+
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("LAMBDA_TASK_ROOT", "/var/task")
+	t.Setenv(envPath, strings.Join([]string{"/opt/php/bin", "/opt/tools"}, sep))
+	t.Setenv(envLdLibraryPath, "/opt/lib")
+
+	configureEnvironment()
+	configureEnvironment()
+
+	// the override replaces the LAMBDA_TASK_ROOT
+	assert.Equal(t, "/usr/bin"+sep+"/opt/php/bin"+sep+"/opt/tools", os.Getenv("PATH"))
+	assert.Equal(t, "/opt/lib", os.Getenv("LD_LIBRARY_PATH"))
+}
+
+func TestConfigureEnvironmentEmptyTaskRoot(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("LAMBDA_TASK_ROOT", "")
+	t.Setenv(envLdLibraryPath, "")
+	t.Setenv(envPath, "")
+	_ = os.Unsetenv(envPath)
+
+	configureEnvironment()
+
+	// no trailing separator, which would add the current directory
+	assert.Equal(t, "/usr/bin", os.Getenv("PATH"))
+}
+
+func TestEmptyTaskRootLogged(t *testing.T) {
+	tests := []struct {
+		name     string
+		taskRoot string
+		path     bool
+		logged   bool
+	}{
+		{name: "empty task root", logged: true},
+		{name: "task root set", taskRoot: "/var/task"},
+		{name: "path override", path: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LAMBDA_TASK_ROOT", tt.taskRoot)
+			t.Setenv(envPath, "/opt/php/bin")
+			if !tt.path {
+				_ = os.Unsetenv(envPath)
+			}
+
+			logs := newTestPlugin(t, &Plugin{}, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil))
+
+			assert.Equal(t, tt.logged, logs.FilterMessage("LAMBDA_TASK_ROOT is empty, it is not added to the PATH").Len() == 1)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+)
+
+// firstContentType returns the first of the Content-Type values API Gateway comma-joined
+// (application/json, text/plain -> application/json), commas in the quoted parameters are kept
+func firstContentType(contentType string) string {
+	quoted := false
+	for i := 0; i < len(contentType); i++ {
+		switch contentType[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return strings.TrimSpace(contentType[:i])
+			}
+		}
+	}
+
+	return contentType
+}
+
+// mediaType returns the lower-cased media type of the (first) Content-Type header value without its parameters
+func mediaType(contentType string) string {
+	contentType = firstContentType(contentType)
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// isBinary reports whether the content type matches one of the configured binary media types.
+// Supports the API Gateway style wildcards: */* and type/*
+func (p *Plugin) isBinary(contentType string) bool {
+	if len(p.cfg.BinaryMediaTypes) == 0 {
+		return false
+	}
+
+	mt := mediaType(contentType)
+	if mt == "" {
+		return false
+	}
+
+	for i := 0; i < len(p.cfg.BinaryMediaTypes); i++ {
+		pattern := p.cfg.BinaryMediaTypes[i]
+		switch {
+		case pattern == "*/*":
+			return true
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(mt, pattern[:len(pattern)-1]) {
+				return true
+			}
+		case pattern == mt:
+			return true
+		}
+	}
+
+	return false
+}
+
+// isText reports whether the content type is a text one: text/*, json, xml, javascript or url-encoded form,
+// including the structured syntax suffixes (application/problem+json)
+func isText(contentType string) bool {
+	mt := mediaType(contentType)
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	}
+
+	return strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name        string
+		types       []string
+		contentType string
+		want        bool
+	}{
+		{name: "no types", contentType: "image/png", want: false},
+		{name: "exact", types: []string{"application/pdf"}, contentType: "application/pdf", want: true},
+		{name: "exact with parameters", types: []string{"application/pdf"}, contentType: "Application/PDF; name=a.pdf", want: true},
+		{name: "exact mismatch", types: []string{"application/pdf"}, contentType: "application/json", want: false},
+		{name: "type wildcard", types: []string{"image/*"}, contentType: "image/png", want: true},
+		{name: "type wildcard mismatch", types: []string{"image/*"}, contentType: "imagex/png", want: false},
+		{name: "any", types: []string{"*/*"}, contentType: "text/html", want: true},
+		{name: "empty content type", types: []string{"*/*"}, contentType: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{cfg: &Config{BinaryMediaTypes: tt.types}}
+			assert.Equal(t, tt.want, p.isBinary(tt.contentType))
+		})
+	}
+}
+
+func TestBinaryMediaTypes(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{BinaryMediaTypes: []string{" Image/* "}}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"content-type": "image/png"},
+		Body:       "png-data",
+	}, &requests))
+
+	// the text body API Gateway base64 encoded is decoded for the worker
+	request := testRequest("/upload")
+	request.Headers["content-type"] = "text/plain"
+	request.Body = base64.StdEncoding.EncodeToString([]byte("hello"))
+	request.IsBase64Encoded = true
+
+	rsp := serve(t, p, request)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "hello", requests[0].Body)
+	assert.False(t, requests[0].IsBase64Encoded)
+
+	// the binary response body is base64 encoded
+	assert.True(t, rsp.IsBase64Encoded)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("png-data")), rsp.Body)
+
+	// the binary request body stays encoded
+	request.Headers["content-type"] = "image/jpeg"
+	serve(t, p, request)
+	require.Len(t, requests, 2)
+	assert.True(t, requests[1].IsBase64Encoded)
+	assert.Equal(t, request.Body, requests[1].Body)
+}
+
+func TestUnlistedBinaryRequestStaysEncoded(t *testing.T) {
+	multipart, multipartType := multipartBody(t, "file", "\xff\xd8\xff")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		decoded     bool
+	}{
+		{name: "text", contentType: "text/plain; charset=utf-8", body: "hello", decoded: true},
+		{name: "json", contentType: "application/problem+json", body: `{"id":1}`, decoded: true},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "a=1&b=2", decoded: true},
+		{name: "multipart", contentType: multipartType, body: multipart},
+		{name: "octet-stream", contentType: "application/octet-stream", body: "\x00\x01\xff"},
+		{name: "no content type", body: "\x00\x01\xff"},
+		{name: "invalid utf-8 text", contentType: "text/plain", body: "caf\xe9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{BinaryMediaTypes: []string{"image/*"}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/upload")
+			if tt.contentType != "" {
+				request.Headers["content-type"] = tt.contentType
+			}
+			request.Body = base64.StdEncoding.EncodeToString([]byte(tt.body))
+			request.IsBase64Encoded = true
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, !tt.decoded, requests[0].IsBase64Encoded)
+
+			body := requests[0].Body
+			if !tt.decoded {
+				decoded, err := base64.StdEncoding.DecodeString(body)
+				require.NoError(t, err)
+				body = string(decoded)
+			}
+			assert.Equal(t, tt.body, body)
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "text/html; charset=utf-8", want: true},
+		{contentType: "Application/JSON", want: true},
+		{contentType: "application/vnd.api+json", want: true},
+		{contentType: "application/atom+xml", want: true},
+		{contentType: "application/x-www-form-urlencoded", want: true},
+		{contentType: "multipart/form-data; boundary=x", want: false},
+		{contentType: "application/pdf", want: false},
+		{contentType: "image/png", want: false},
+		{contentType: "", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isText(tt.contentType), tt.contentType)
+	}
+}
+
+func TestFirstContentType(t *testing.T) {
+	tests := []struct {
+		in        string
+		want      string
+		wantMedia string
+	}{
+		{in: "application/json", want: "application/json", wantMedia: "application/json"},
+		{in: "application/json, text/plain", want: "application/json", wantMedia: "application/json"},
+		{in: "Text/HTML; charset=utf-8,application/json", want: "Text/HTML; charset=utf-8", wantMedia: "text/html"},
+		// the comma inside the quoted boundary doesn't split the value
+		{in: `multipart/form-data; boundary="a,b", text/plain`, want: `multipart/form-data; boundary="a,b"`, wantMedia: "multipart/form-data"},
+		{in: "", want: "", wantMedia: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, firstContentType(tt.in), tt.in)
+		assert.Equal(t, tt.wantMedia, mediaType(tt.in), tt.in)
+	}
+}
+
+func TestCommaJoinedContentType(t *testing.T) {
+	p := &Plugin{cfg: &Config{BinaryMediaTypes: []string{"image/*"}}}
+	assert.True(t, p.isBinary("image/png, text/plain"))
+	assert.False(t, p.isBinary("text/plain, image/png"))
+
+	// the multipart check uses the first value boundary
+	body, ct := multipartBody(t, "test", "content")
+	request := testRequest("/upload")
+	request.Headers["content-type"] = ct + ", text/plain"
+	request.Body = body
+	require.NoError(t, validateMultipart(zap.NewNop(), &request, 0))
+}
+
+func TestBinarySafe(t *testing.T) {
+	tests := []struct {
+		name       string
+		binarySafe bool
+		body       string
+		base64     bool
+		wantBody   string
+		wantBase64 bool
+	}{
+		{name: "text encoded", binarySafe: true, body: `{"id":1}`, wantBody: base64.StdEncoding.EncodeToString([]byte(`{"id":1}`)), wantBase64: true},
+		{name: "already encoded", binarySafe: true, body: "eyJpZCI6MX0=", base64: true, wantBody: "eyJpZCI6MX0=", wantBase64: true},
+		{name: "empty body", binarySafe: true, body: "", wantBody: ""},
+		{name: "disabled", binarySafe: false, body: `{"id":1}`, wantBody: `{"id":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": "application/json"}
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{BinarySafe: tt.binarySafe}, respond(events.APIGatewayV2HTTPResponse{
+				StatusCode: 200, Headers: headers, Body: tt.body, IsBase64Encoded: tt.base64,
+			}, nil))
+
+			rsp := serve(t, p, testRequest("/users"))
+			assert.Equal(t, tt.wantBody, rsp.Body)
+			assert.Equal(t, tt.wantBase64, rsp.IsBase64Encoded)
+
+			alb := &Plugin{}
+			newTestPlugin(t, alb, &Config{EventType: eventTypeALB, BinarySafe: tt.binarySafe}, respond(events.ALBTargetGroupResponse{
+				StatusCode: 200, Headers: headers, Body: tt.body, IsBase64Encoded: tt.base64,
+			}, nil))
+
+			albRsp, err := alb.albHandler()(testContext(), events.ALBTargetGroupRequest{HTTPMethod: "GET", Path: "/users"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, albRsp.Body)
+			assert.Equal(t, tt.wantBase64, albRsp.IsBase64Encoded)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// validateMultipart rejects the multipart requests with a missing boundary, a body that doesn't use it
+// or more than maxParts parts (0 - unlimited),
+// so the client gets a clear 400 instead of a parser error from the worker (the parser errors are only logged).
+// The body is not checked while it is still compressed (Content-Encoding without decompress_request)
+func validateMultipart(log *zap.Logger, request *events.APIGatewayV2HTTPRequest, maxParts int) error {
+	contentType := firstContentType(getHeader(request.Headers, "content-type"))
+	if !strings.HasPrefix(mediaType(contentType), "multipart/") {
+		return nil
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return newStatusError(http.StatusBadRequest, "invalid multipart: malformed content type")
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return newStatusError(http.StatusBadRequest, "invalid multipart: missing boundary")
+	}
+
+	// the worker decodes the body itself
+	if contentEncoded(getHeader(request.Headers, "content-encoding")) {
+		return nil
+	}
+
+	body := request.Body
+	if request.IsBase64Encoded {
+		b, err := decodeBase64(request.Body)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid base64 body")
+		}
+
+		body = string(b)
+	}
+
+	if body != "" && !strings.Contains(body, "--"+boundary) {
+		return newStatusError(http.StatusBadRequest, "invalid multipart: body does not match the boundary")
+	}
+
+	if maxParts > 0 && body != "" {
+		return checkParts(log, body, boundary, maxParts)
+	}
+
+	return nil
+}
+
+// checkParts rejects the multipart bodies with more than maxParts parts (values and files combined)
+// and the malformed ones, the parser error is logged at the debug level and not sent to the client
+func checkParts(log *zap.Logger, body, boundary string, maxParts int) error {
+	mr := multipart.NewReader(strings.NewReader(body), boundary)
+	for n := 0; ; n++ {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			log.Debug("failed to parse the multipart body", zap.Error(err))
+			return newStatusError(http.StatusBadRequest, "invalid multipart: malformed part")
+		}
+
+		_ = part.Close()
+
+		if n >= maxParts {
+			return newStatusError(http.StatusBadRequest, "invalid multipart: too many parts")
+		}
+	}
+}
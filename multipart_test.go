@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidateMultipart(t *testing.T) {
+	body, contentType := multipartBody(t, "name", "avatar.png")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "valid", contentType: contentType, body: body, status: http.StatusOK},
+		{name: "not multipart", contentType: "text/plain", body: "text", status: http.StatusOK},
+		{name: "missing boundary", contentType: "multipart/form-data", body: body, status: http.StatusBadRequest},
+		{name: "empty boundary", contentType: "multipart/form-data; boundary=", body: body, status: http.StatusBadRequest},
+		{name: "malformed content type", contentType: "multipart/form-data; boundary", body: body, status: http.StatusBadRequest},
+		{name: "boundary mismatch", contentType: "multipart/form-data; boundary=other", body: body, status: http.StatusBadRequest},
+		{name: "empty body", contentType: contentType, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/upload")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Headers["content-type"] = tt.contentType
+			request.Body = tt.body
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+
+			if tt.status == http.StatusBadRequest {
+				assert.Contains(t, rsp.Body, "invalid multipart")
+				assert.Empty(t, requests)
+			}
+		})
+	}
+}
+
+func TestValidateMultipartCompressedBody(t *testing.T) {
+	body, contentType := multipartBody(t, "name", "avatar.png")
+
+	for _, decompress := range []bool{false, true} {
+		var requests []events.APIGatewayV2HTTPRequest
+
+		p := &Plugin{}
+		newTestPlugin(t, p, &Config{DecompressRequest: decompress}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+		request := testRequest("/upload")
+		request.RequestContext.HTTP.Method = http.MethodPost
+		request.Headers["content-type"] = contentType
+		request.Headers["content-encoding"] = encodingGzip
+		request.Body = base64.StdEncoding.EncodeToString(compressBody(t, encodingGzip, []byte(body)))
+		request.IsBase64Encoded = true
+
+		rsp := serve(t, p, request)
+		require.Equal(t, http.StatusOK, rsp.StatusCode, "decompress_request: %v", decompress)
+		require.Len(t, requests, 1)
+
+		// without decompress_request the worker gets the gzipped body as is
+		assert.Equal(t, !decompress, getHeader(requests[0].Headers, "content-encoding") == encodingGzip)
+	}
+}
+
+func TestMultipartMaxParts(t *testing.T) {
+	// a value and a file
+	body, contentType := multipartBody(t, "name", "avatar.png")
+
+	tests := []struct {
+		name     string
+		maxParts int
+		body     string
+		status   int
+		msg      string
+		// the parser error logged instead of being sent to the client
+		cause string
+	}{
+		{name: "unlimited", maxParts: 0, body: body, status: http.StatusOK},
+		{name: "within the limit", maxParts: 3, body: body, status: http.StatusOK},
+		{name: "at the limit", maxParts: 2, body: body, status: http.StatusOK},
+		{name: "over the limit", maxParts: 1, body: body, status: http.StatusBadRequest, msg: "invalid multipart: too many parts"},
+		{name: "truncated", maxParts: 5, body: body[:len(body)/2], status: http.StatusBadRequest, msg: "invalid multipart: malformed part", cause: "malformed MIME header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			logs := newTestPlugin(t, p, &Config{Uploads: UploadsConfig{MaxParts: tt.maxParts}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/upload")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Headers["content-type"] = contentType
+			request.Body = tt.body
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+			if tt.status != http.StatusOK {
+				assert.Equal(t, tt.msg, rsp.Body)
+				assert.Empty(t, requests)
+			}
+
+			entries := logs.FilterMessage("failed to parse the multipart body").All()
+			if tt.cause == "" {
+				assert.Empty(t, entries)
+				return
+			}
+
+			require.Len(t, entries, 1)
+			assert.Contains(t, entries[0].ContextMap()["error"], tt.cause)
+		})
+	}
+}
+
+func FuzzValidateMultipart(f *testing.F) {
+	body, contentType := multipartBody(f, "name", "avatar.png")
+	f.Add(contentType, body, 0)
+	f.Add(contentType, body, 1)
+	f.Add(contentType, body[:len(body)/2], 5)
+	f.Add("multipart/form-data", body, 0)
+	f.Add(`multipart/form-data; boundary="a,b", text/plain`, "--a,b\r\n\r\nx\r\n--a,b--\r\n", 3)
+	f.Add("multipart/mixed; boundary=x", "--x\r\nContent-Type text/plain\r\n\r\n--x--", 2)
+
+	f.Fuzz(func(t *testing.T, contentType, body string, maxParts int) {
+		request := testRequest("/upload")
+		request.Headers["content-type"] = contentType
+		request.Body = body
+
+		err := validateMultipart(zap.NewNop(), &request, maxParts)
+		if err == nil {
+			return
+		}
+
+		// the client always gets a clean 400
+		var se *statusError
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, http.StatusBadRequest, se.status)
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOtelSpan(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+	sr := tracetest.NewSpanRecorder()
+
+	p := &Plugin{spanProcessor: sr}
+	newTestPlugin(t, p, &Config{Otel: OtelConfig{Enabled: true, ServiceName: "app"}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusCreated}, &requests))
+
+	request := testRequest("/users")
+	request.RouteKey = "POST /users"
+	request.RequestContext.HTTP.Method = http.MethodPost
+	request.Headers["traceparent"] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	rsp := serve(t, p, request)
+	require.Equal(t, http.StatusCreated, rsp.StatusCode)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "POST /users", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.Parent().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.True(t, span.Parent().IsRemote())
+
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("http.request.method", http.MethodPost),
+		attribute.String("http.route", "POST /users"),
+		attribute.String("url.path", "/users"),
+		attribute.String("faas.invocation_id", testRequestID),
+		attribute.Int("http.response.status_code", http.StatusCreated),
+	}, span.Attributes())
+
+	service, ok := span.Resource().Set().Value("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "app", service.AsString())
+
+	// the worker continues the invocation span
+	require.Len(t, requests, 1)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01", requests[0].Headers["traceparent"])
+}
+
+func TestOtelSpanWorkerError(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+
+	p := &Plugin{spanProcessor: sr}
+	newTestPlugin(t, p, &Config{Otel: OtelConfig{Enabled: true}}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		return nil, errors.Str("worker failed")
+	})
+
+	rsp := serve(t, p, testRequest("/users"))
+	require.Equal(t, http.StatusInternalServerError, rsp.StatusCode)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, "exception", spans[0].Events()[0].Name)
+}
+
+func TestOtelDisabled(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+
+	p := &Plugin{spanProcessor: sr}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil))
+
+	serve(t, p, testRequest("/users"))
+	assert.Nil(t, p.tracerProvider)
+	assert.Empty(t, sr.Started())
+}
+
+func TestOtelExporterValidation(t *testing.T) {
+	cfg := &Config{Otel: OtelConfig{Exporter: "otlp"}}
+	assert.ErrorContains(t, cfg.InitDefaults(), "unknown otel exporter: otlp")
+
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "my-function")
+	cfg = &Config{}
+	require.NoError(t, cfg.InitDefaults())
+	assert.Equal(t, otelExporterStdout, cfg.Otel.Exporter)
+	assert.Equal(t, "my-function", cfg.Otel.ServiceName)
+}
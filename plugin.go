@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/endure/v2/dep"
 	"github.com/roadrunner-server/errors"
 	"github.com/roadrunner-server/goridge/v3/pkg/frame"
 	"github.com/roadrunner-server/pool/pool"
@@ -13,21 +18,64 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/roadrunner-server/pool/payload"
 	poolImp "github.com/roadrunner-server/pool/pool/static_pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
 	pluginName string = "lambda"
+	// retryAfter is the Retry-After value (seconds) sent with the 503 responses
+	retryAfter string = "1"
 )
 
 type Plugin struct {
-	mu      sync.Mutex
+	mu      sync.RWMutex
+	cfg     *Config
 	log     *zap.Logger
-	srv     Server
 	pldPool sync.Pool
-	wrkPool Pool
+	bufPool sync.Pool
+	// payload context attributes
+	attrPool sync.Pool
+	wrkPool  Pool
+	// path prefix routes, sorted by the prefix length
+	routes []*route
+	// limits concurrent executions, nil when unlimited
+	sem chan struct{}
+	// the reset sentinel modification time seen by the last check
+	sentinel time.Time
+	// processed sqs messages, nil when the deduplication is disabled
+	idempotency *idempotency
+	// http events interceptors
+	reqInterceptors []RequestInterceptor
+	rspInterceptors []ResponseInterceptor
+	// lambda handlers by the event type
+	handlers map[string]any
+	// handler for the configured event type
+	eventHandler any
+	// starts the lambda runtime loop with the handler, lambda.Start unless replaced (e.g. by a fake runtime)
+	start func(handler any)
+	// creates the workers pool, the server plugin NewPool unless replaced (e.g. by a fake pool)
+	poolFactory func(ctx context.Context, cfg *pool.Config, env map[string]string) (Pool, error)
+	// executes the payload on the pool worker and returns the worker response, execPool unless replaced
+	execPayload func(ctx context.Context, wp Pool, pld *payload.Payload) (*payload.Payload, error)
+	// processes the finished spans, the otel.exporter one unless replaced (e.g. by a span recorder)
+	spanProcessor sdktrace.SpanProcessor
+	// the spans tracer provider, nil when otel is disabled
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// Configurer provides access to the RR configuration
+type Configurer interface {
+	// UnmarshalKey takes a single key and unmarshal it into a Struct.
+	UnmarshalKey(name string, out any) error
+	// Has checks if a config section exists.
+	Has(name string) bool
 }
 
 // Logger plugin
@@ -55,18 +103,84 @@ type Server interface {
 	NewPool(ctx context.Context, cfg *pool.Config, env map[string]string, _ *zap.Logger) (*poolImp.Pool, error)
 }
 
-func (p *Plugin) Init(srv Server, log Logger) error {
-	p.srv = srv
+func (p *Plugin) Init(cfg Configurer, srv Server, log Logger) error {
+	const op = errors.Op("plugin_init")
+
+	p.cfg = &Config{}
+	// the lambda section is optional, defaults are used when it is absent
+	if cfg.Has(pluginName) {
+		err := cfg.UnmarshalKey(pluginName, p.cfg)
+		if err != nil {
+			return errors.E(op, errors.Init, err)
+		}
+	}
+
+	err := p.cfg.InitDefaults()
+	if err != nil {
+		return errors.E(op, errors.Init, err)
+	}
+
+	if p.start == nil {
+		p.start = lambda.Start
+	}
+
+	if p.poolFactory == nil {
+		p.poolFactory = func(ctx context.Context, cfg *pool.Config, env map[string]string) (Pool, error) {
+			wp, errP := srv.NewPool(ctx, cfg, env, nil)
+			if errP != nil {
+				// the nil pool must not become a non-nil interface
+				return nil, errP
+			}
+
+			return wp, nil
+		}
+	}
+
+	if p.execPayload == nil {
+		p.execPayload = execPool
+	}
+
+	if p.cfg.Otel.Enabled {
+		p.tracerProvider, err = newTracerProvider(&p.cfg.Otel, p.spanProcessor)
+		if err != nil {
+			return errors.E(op, errors.Init, err)
+		}
+	}
+
+	codec := codecFlag(p.cfg.Codec)
+
+	if p.cfg.Idempotency.TTL > 0 {
+		p.idempotency = newIdempotency(p.cfg.Idempotency.TTL)
+	}
+
+	if p.cfg.MaxConcurrency > 0 {
+		p.sem = make(chan struct{}, p.cfg.MaxConcurrency)
+	}
+
 	p.log = log.NamedLogger(pluginName)
+	// configureEnvironment runs before the logger exists, the skipped LAMBDA_TASK_ROOT is reported here
+	if _, ok := os.LookupEnv(envPath); !ok && os.Getenv("LAMBDA_TASK_ROOT") == "" {
+		p.log.Debug("LAMBDA_TASK_ROOT is empty, it is not added to the PATH")
+	}
 	p.pldPool = sync.Pool{
 		New: func() any {
 			return &payload.Payload{
-				Codec:   frame.CodecJSON,
+				Codec:   codec,
 				Context: make([]byte, 0, 100),
 				Body:    make([]byte, 0, 100),
 			}
 		},
 	}
+	p.attrPool = sync.Pool{
+		New: func() any {
+			return make(map[string]string, 10)
+		},
+	}
+	p.bufPool = sync.Pool{
+		New: func() any {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
 
 	return nil
 }
@@ -78,20 +192,50 @@ func (p *Plugin) Serve() chan error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	// the custom handlers are collected after Init
+	p.registerBuiltinHandlers()
 	var err error
-	p.wrkPool, err = p.srv.NewPool(context.Background(), &pool.Config{
-		NumWorkers:      4,
-		AllocateTimeout: time.Second * 20,
-		DestroyTimeout:  time.Second * 20,
-	}, nil, nil)
+	p.eventHandler, err = p.handlerFor(p.cfg.EventType)
+	if err != nil {
+		errCh <- errors.E(op, err)
+		return errCh
+	}
+
+	p.checkMemoryLimit()
+
+	if p.cfg.ResetSentinel != "" {
+		p.sentinel = sentinelState(p.cfg.ResetSentinel)
+	}
+
+	p.wrkPool, err = p.newPool(nil)
 	if err != nil {
 		errCh <- errors.E(op, err)
 		return errCh
 	}
 
+	p.routes = make([]*route, 0, len(p.cfg.Routes))
+	for i := 0; i < len(p.cfg.Routes); i++ {
+		rp, errR := p.newPool(p.cfg.Routes[i].Command)
+		if errR != nil {
+			errCh <- errors.E(op, errors.Errorf("route %s: %v", p.cfg.Routes[i].Prefix, errR))
+			return errCh
+		}
+
+		p.routes = append(p.routes, &route{prefix: p.cfg.Routes[i].Prefix, pool: rp})
+	}
+
+	sortRoutes(p.routes)
+
 	go func() {
-		// register handler
-		lambda.Start(p.handler())
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- errors.E(op, errors.Errorf("lambda runtime panic: %v", r))
+			}
+		}()
+
+		// register handler, in normal operation Start never returns
+		p.start(p.eventHandler)
+		errCh <- errors.E(op, errors.Str("lambda runtime loop exited"))
 	}()
 
 	return errCh
@@ -105,57 +249,430 @@ func (p *Plugin) Stop(ctx context.Context) error {
 		p.wrkPool.Destroy(ctx)
 	}
 
+	for i := 0; i < len(p.routes); i++ {
+		p.routes[i].pool.Destroy(ctx)
+	}
+
+	if p.tracerProvider != nil {
+		// the remaining spans are flushed
+		return p.tracerProvider.Shutdown(ctx)
+	}
+
 	return nil
 }
 
-func (p *Plugin) handler() func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-		requestJSON, err := json.Marshal(request)
-		if err != nil {
-			return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: 500}, nil
+// Name returns the plugin name, used by endure to identify the plugin
+func (p *Plugin) Name() string {
+	return pluginName
+}
+
+// Collects collects the request and response interceptors and the custom event handlers from the registered plugins,
+// the interceptors are invoked in the order they are collected
+func (p *Plugin) Collects() []*dep.In {
+	return []*dep.In{
+		dep.Fits(func(pl any) {
+			p.addEventHandler(pl.(EventHandler))
+		}, (*EventHandler)(nil)),
+		dep.Fits(func(pl any) {
+			p.mu.Lock()
+			p.reqInterceptors = append(p.reqInterceptors, pl.(RequestInterceptor))
+			p.mu.Unlock()
+		}, (*RequestInterceptor)(nil)),
+		dep.Fits(func(pl any) {
+			p.mu.Lock()
+			p.rspInterceptors = append(p.rspInterceptors, pl.(ResponseInterceptor))
+			p.mu.Unlock()
+		}, (*ResponseInterceptor)(nil)),
+	}
+}
+
+// Ready reports whether the workers pool is created and has at least one live (ready or working) worker.
+// The plugin is not ready while the pools are created or reset (the exclusive lock is held), the probe doesn't wait for it
+func (p *Plugin) Ready() bool {
+	if !p.mu.TryRLock() {
+		return false
+	}
+	defer p.mu.RUnlock()
+
+	if p.wrkPool == nil {
+		return false
+	}
+
+	workers := p.wrkPool.Workers()
+	for i := 0; i < len(workers); i++ {
+		if workers[i].State().IsActive() {
+			return true
 		}
+	}
 
-		ctxJSON, err := json.Marshal(ctx)
+	return false
+}
+
+// handler handles the API Gateway HTTP API (payload format 2.0 and 1.0) and REST API events. The worker always
+// receives the 2.0 request and responds with the 2.0 response, the 1.0 ones are converted
+func (p *Plugin) handler() func(ctx context.Context, event json.RawMessage) (any, error) {
+	return func(ctx context.Context, event json.RawMessage) (any, error) {
+		const op = errors.Op("lambda_http_handler")
+
+		var format payloadFormat
+		err := json.Unmarshal(event, &format)
 		if err != nil {
-			return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: 500}, nil
+			return nil, errors.E(op, err)
 		}
 
-		pld := p.getPld()
-		defer p.putPld(pld)
+		if !format.v1() {
+			var request events.APIGatewayV2HTTPRequest
+			err = json.Unmarshal(event, &request)
+			if err != nil {
+				return nil, errors.E(op, err)
+			}
 
-		pld.Body = requestJSON
-		pld.Context = ctxJSON
+			return p.serveHTTP(ctx, event, request), nil
+		}
 
-		re, err := p.wrkPool.Exec(ctx, pld, nil)
+		var request events.APIGatewayProxyRequest
+		err = json.Unmarshal(event, &request)
 		if err != nil {
-			return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: 500}, nil
+			return nil, errors.E(op, err)
 		}
 
-		var r *payload.Payload
+		response := p.serveHTTP(ctx, event, v2Request(&request))
+		return v1Response(&response), nil
+	}
+}
 
-		select {
-		case pl := <-re:
-			if pl.Error() != nil {
-				return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: 500}, nil
-			}
-			// streaming is not supported
-			if pl.Payload().Flags&frame.STREAM != 0 {
-				return events.APIGatewayV2HTTPResponse{Body: "streaming is not supported", StatusCode: 500}, nil
-			}
+// serveHTTP handles the http request, event is the original lambda event. The configured response headers are added
+// to every response (the errors, the health check and the interceptor ones included), the size is checked last
+func (p *Plugin) serveHTTP(ctx context.Context, event json.RawMessage, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	response := p.serveRequest(ctx, event, request)
+	p.responseHeaders(&response)
+
+	err := p.checkResponseSize(ctx, &response)
+	if err != nil {
+		response = errorResponse(err)
+		p.responseHeaders(&response)
+	}
+
+	return response
+}
+
+// serveRequest returns the health check, the interceptor, the error or the prepared worker response
+func (p *Plugin) serveRequest(ctx context.Context, event json.RawMessage, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	if p.cfg.HealthPath != "" && request.RawPath == p.cfg.HealthPath {
+		return p.healthResponse()
+	}
+
+	p.checkSentinel(ctx)
+
+	if !p.acquire() {
+		// fail fast instead of queueing inside the pool
+		return unavailableResponse()
+	}
+	defer p.release()
+
+	attrs := p.getAttrs()
+	defer p.putAttrs(attrs)
+
+	// before the request is modified
+	if p.cfg.PassRawEvent {
+		p.setRawEvent(ctx, event, attrs)
+	}
+
+	err := p.prepareRequest(&request)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if p.cfg.Otel.Enabled {
+		ctx, span = p.startSpan(ctx, &request)
+		defer span.End()
+	}
+
+	setTraceparent(ctx, request.Headers)
+
+	rsp, err := p.interceptRequest(ctx, &request)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if rsp != nil {
+		return *rsp
+	}
 
-			// assign the payload
-			r = pl.Payload()
-		default:
-			return events.APIGatewayV2HTTPResponse{Body: "worker empty response", StatusCode: 500}, nil
+	fillAttributes(ctx, &request, attrs)
+
+	var response events.APIGatewayV2HTTPResponse
+	start := time.Now()
+	err = p.invoke(ctx, p.selectPool(request.RawPath), request, attrs, &response)
+	p.logSlow(ctx, &request, time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "worker exec failed")
+
+		// all workers are busy, let the client retry
+		if errors.Is(errors.NoFreeWorkers, err) || errors.Is(errors.QueueSize, err) {
+			return unavailableResponse()
 		}
 
-		var response events.APIGatewayV2HTTPResponse
-		err = json.Unmarshal(r.Body, &response)
-		if err != nil {
-			return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: 500}, nil
+		return errorResponse(err)
+	}
+
+	p.prepareResponse(ctx, &request, &response)
+	span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+
+	err = p.interceptResponse(ctx, &request, &response)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return response
+}
+
+// logSlow warns about the requests which took longer than the slow_threshold
+func (p *Plugin) logSlow(ctx context.Context, request *events.APIGatewayV2HTTPRequest, elapsed time.Duration) {
+	if p.cfg.SlowThreshold <= 0 || elapsed <= p.cfg.SlowThreshold {
+		return
+	}
+
+	uri := request.RawPath
+	if request.RawQueryString != "" {
+		uri += "?" + request.RawQueryString
+	}
+
+	fields := []zap.Field{
+		zap.String("request_id", requestID(ctx)),
+		zap.String("method", request.RequestContext.HTTP.Method),
+		zap.String("uri", uri),
+		zap.Duration("elapsed", elapsed),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		fields = append(fields, zap.Duration("remaining", time.Until(deadline)))
+	}
+
+	p.log.Warn("slow request", fields...)
+}
+
+// invoke encodes the event and the attributes, executes them on the worker and decodes the worker response into out.
+// The worker response is ignored when out is nil
+func (p *Plugin) invoke(ctx context.Context, wp Pool, event any, attrs map[string]string, out any) error {
+	// payload body and context are encoded into the pooled buffers, which are
+	// returned only after the worker response is decoded
+	bodyBuf := p.getBuf()
+	defer p.putBuf(bodyBuf)
+	ctxBuf := p.getBuf()
+	defer p.putBuf(ctxBuf)
+
+	var err error
+	switch ev := event.(type) {
+	case json.RawMessage:
+		err = p.encodeRaw(bodyBuf, ev)
+	default:
+		err = p.encode(bodyBuf, ev)
+	}
+	if err != nil {
+		// the details are only logged, the client gets the bare 500
+		p.log.Error("failed to encode the event", zap.String("request_id", requestID(ctx)), zap.Error(err))
+		return err
+	}
+
+	err = p.encode(ctxBuf, attrs)
+	if err != nil {
+		p.log.Error("failed to encode the attributes", zap.String("request_id", requestID(ctx)), zap.Error(err))
+		return err
+	}
+
+	r, err := p.exec(ctx, wp, bodyBuf.Bytes(), ctxBuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = p.decode(r.Body, out)
+	if err != nil {
+		p.log.Error("failed to decode the worker response", zap.String("request_id", requestID(ctx)), zap.ByteString("body", r.Body), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// exec sends the payload to the worker and returns the worker response
+func (p *Plugin) exec(ctx context.Context, wp Pool, body, pldCtx []byte) (*payload.Payload, error) {
+	pld := p.getPld()
+	defer p.putPld(pld)
+
+	pld.Body = body
+	pld.Context = pldCtx
+
+	// capped by the lambda deadline
+	if p.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	rsp, err := p.execPayload(ctx, wp, pld)
+	if err != nil {
+		p.log.Error("worker exec failed", zap.String("request_id", requestID(ctx)), zap.Error(err))
+		if ctx.Err() != nil || errors.Is(errors.ExecTTL, err) {
+			return nil, p.timeoutError(nil)
 		}
-		return response, nil
+
+		// the failed worker is not removed here: the pool marks it errored, stops it and allocates a new one,
+		// while RemoveWorker can't target it and would stop a healthy idle worker instead
+		return nil, err
+	}
+
+	// the deadline is hit while the worker was producing the response
+	if ctx.Err() != nil {
+		p.log.Warn("request timeout exceeded", zap.String("request_id", requestID(ctx)))
+		return nil, p.timeoutError(rsp.Body)
+	}
+
+	// streaming is not supported
+	if rsp.Flags&frame.STREAM != 0 {
+		return nil, newStatusError(http.StatusInternalServerError, "streaming is not supported")
 	}
+
+	return rsp, nil
+}
+
+// execPool executes the payload on the pool worker and returns the first response frame
+func execPool(ctx context.Context, wp Pool, pld *payload.Payload) (*payload.Payload, error) {
+	re, err := wp.Exec(ctx, pld, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case pl := <-re:
+		if pl.Error() != nil {
+			return nil, pl.Error()
+		}
+
+		return pl.Payload(), nil
+	default:
+		return nil, newStatusError(http.StatusInternalServerError, "worker empty response")
+	}
+}
+
+// timeoutError returns the 504 error (request_timeout or the lambda deadline exceeded). The worker response completed
+// after the deadline is included when the timeout.include_late_response is on and the codec is json
+func (p *Plugin) timeoutError(late []byte) error {
+	const msg = "request timeout exceeded"
+
+	if !p.cfg.Timeout.IncludeLateResponse || p.cfg.Codec != codecJSON || len(late) == 0 {
+		return newStatusError(http.StatusGatewayTimeout, msg)
+	}
+
+	return newStatusError(http.StatusGatewayTimeout, msg+", late worker response:\n"+string(late))
+}
+
+// acquire takes the concurrency slot, false is returned when the max_concurrency limit is reached
+func (p *Plugin) acquire() bool {
+	if p.sem == nil {
+		return true
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees the slot taken by acquire
+func (p *Plugin) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+// newPool creates the workers pool. All the workers are spawned in parallel (bounded by the allocate timeout)
+// before it returns, so the first requests after a cold start don't wait for the workers bootstrap
+func (p *Plugin) newPool(command []string) (Pool, error) {
+	start := time.Now()
+	cfg := p.poolConfig(command)
+
+	wp, err := p.poolFactory(context.Background(), cfg, p.cfg.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wp.Workers())
+	if uint64(n) < cfg.NumWorkers {
+		wp.Destroy(context.Background())
+		return nil, errors.Errorf("workers warm-up failed: %d of %d workers are ready", n, cfg.NumWorkers)
+	}
+
+	p.log.Debug("workers are ready", zap.Int("workers", n), zap.Duration("elapsed", time.Since(start)))
+
+	return wp, nil
+}
+
+// checkMemoryLimit logs the workers memory limit and warns when the workers at the limit don't fit into the function memory.
+// The pool supervisor recycles the workers exceeding the limit, the recycling is logged by the server plugin logger
+// (debug level, memory_limit message), not by this plugin
+func (p *Plugin) checkMemoryLimit() {
+	sv := p.cfg.Pool.Supervisor
+	if sv == nil || sv.MaxWorkerMemory == 0 {
+		return
+	}
+
+	workers := p.cfg.Pool.NumWorkers * uint64(len(p.cfg.Routes)+1)
+	p.log.Info("workers exceeding the memory limit are recycled", zap.Uint64("max_worker_memory_mb", sv.MaxWorkerMemory), zap.Uint64("workers", workers))
+
+	// the function memory size in MB
+	fnMemory, err := strconv.ParseUint(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	if sv.MaxWorkerMemory*workers >= fnMemory {
+		p.log.Warn("workers memory limit exceeds the function memory, lambda may kill the container before the workers are recycled",
+			zap.Uint64("max_worker_memory_mb", sv.MaxWorkerMemory),
+			zap.Uint64("workers", workers),
+			zap.Uint64("function_memory_mb", fnMemory),
+		)
+	}
+}
+
+// poolConfig returns the copy of the configured workers pool settings, the command overrides the server command when not empty
+func (p *Plugin) poolConfig(command []string) *pool.Config {
+	cfg := *p.cfg.Pool
+	cfg.Command = command
+
+	if cfg.Supervisor != nil {
+		sv := *cfg.Supervisor
+		cfg.Supervisor = &sv
+	}
+
+	// the pool kills (and replaces) the worker which exceeded the exec ttl
+	if p.cfg.RequestTimeout > 0 {
+		if cfg.Supervisor == nil {
+			cfg.Supervisor = &pool.SupervisorConfig{}
+		}
+
+		cfg.Supervisor.ExecTTL = p.cfg.RequestTimeout
+	}
+
+	return &cfg
+}
+
+// requestID returns the AWS request id of the current invocation
+func requestID(ctx context.Context) string {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return lc.AwsRequestID
 }
 
 func (p *Plugin) putPld(pld *payload.Payload) {
@@ -168,3 +685,12 @@ func (p *Plugin) getPld() *payload.Payload {
 	pld := p.pldPool.Get().(*payload.Payload)
 	return pld
 }
+
+func (p *Plugin) putBuf(buf *bytes.Buffer) {
+	buf.Reset()
+	p.bufPool.Put(buf)
+}
+
+func (p *Plugin) getBuf() *bytes.Buffer {
+	return p.bufPool.Get().(*bytes.Buffer)
+}
@@ -0,0 +1,828 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/fsm"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/roadrunner-server/pool/pool"
+	poolImp "github.com/roadrunner-server/pool/pool/static_pool"
+	"github.com/roadrunner-server/pool/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testRequestID string = "c6af9ac6-7b61-11e6-9a41-93e8deadbeef"
+
+// execFunc handles the payloads sent to the fake workers
+type execFunc func(ctx context.Context, pld *payload.Payload) (*payload.Payload, error)
+
+type testConfigurer struct {
+	cfg *Config
+}
+
+func (c *testConfigurer) UnmarshalKey(_ string, out any) error {
+	*out.(*Config) = *c.cfg
+	return nil
+}
+
+func (c *testConfigurer) Has(string) bool {
+	return c.cfg != nil
+}
+
+type testLogger struct {
+	log *zap.Logger
+}
+
+func (l *testLogger) NamedLogger(string) *zap.Logger {
+	return l.log
+}
+
+// testPool is the workers pool with the workers which are never started, the payloads are handled by exec
+type testPool struct {
+	mu        sync.Mutex
+	cfg       *pool.Config
+	workers   []*worker.Process
+	exec      execFunc
+	resets    int
+	removed   int
+	added     int
+	destroyed bool
+}
+
+func newTestPool(t testing.TB, cfg *pool.Config, fn execFunc) *testPool {
+	tp := &testPool{cfg: cfg, exec: fn}
+	for i := uint64(0); i < cfg.NumWorkers; i++ {
+		w, err := worker.InitBaseWorker(exec.Command("true"), worker.WithLog(zap.NewNop()))
+		require.NoError(t, err)
+		w.State().Transition(fsm.StateReady)
+		tp.workers = append(tp.workers, w)
+	}
+
+	return tp
+}
+
+func (tp *testPool) Workers() []*worker.Process {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	return tp.workers
+}
+
+func (tp *testPool) Exec(context.Context, *payload.Payload, chan struct{}) (chan *poolImp.PExec, error) {
+	return nil, errors.Str("the fake pool is executed by the plugin execPayload")
+}
+
+func (tp *testPool) RemoveWorker(context.Context) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.removed++
+	return nil
+}
+
+func (tp *testPool) AddWorker() error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.added++
+	return nil
+}
+
+func (tp *testPool) Reset(context.Context) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.resets++
+	return nil
+}
+
+func (tp *testPool) Destroy(context.Context) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.destroyed = true
+}
+
+// setTestPools replaces the workers pools with the fake ones
+func setTestPools(t testing.TB, p *Plugin, fn execFunc) {
+	p.poolFactory = func(_ context.Context, cfg *pool.Config, _ map[string]string) (Pool, error) {
+		return newTestPool(t, cfg, fn), nil
+	}
+	p.execPayload = func(ctx context.Context, wp Pool, pld *payload.Payload) (*payload.Payload, error) {
+		return wp.(*testPool).exec(ctx, pld)
+	}
+}
+
+// newTestPlugin initializes and serves the plugin with the fake pools, the fields set on p (e.g. start) are kept
+func newTestPlugin(t testing.TB, p *Plugin, cfg *Config, fn execFunc, plugins ...any) *observer.ObservedLogs {
+	setTestPools(t, p, fn)
+	return startTestPlugin(t, p, cfg, plugins...)
+}
+
+// startTestPlugin initializes and serves the plugin, the runtime loop blocks until the test ends unless p.start is set.
+// The plugins are collected between Init and Serve, the same as endure does
+func startTestPlugin(t testing.TB, p *Plugin, cfg *Config, plugins ...any) *observer.ObservedLogs {
+	core, logs := observer.New(zap.DebugLevel)
+
+	if p.start == nil {
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			close(done)
+		})
+
+		p.start = func(any) {
+			<-done
+		}
+	}
+
+	if cfg.Pool == nil {
+		cfg.Pool = &pool.Config{NumWorkers: 1}
+	}
+
+	require.NoError(t, p.Init(&testConfigurer{cfg: cfg}, nil, &testLogger{log: zap.New(core)}))
+	collect(p, plugins...)
+
+	select {
+	case err := <-p.Serve():
+		require.NoError(t, err)
+	default:
+	}
+
+	t.Cleanup(func() {
+		_ = p.Stop(context.Background())
+	})
+
+	return logs
+}
+
+// collect passes the plugins to the matching Collects callbacks
+func collect(p *Plugin, plugins ...any) {
+	for _, in := range p.Collects() {
+		for i := 0; i < len(plugins); i++ {
+			if reflect.TypeOf(plugins[i]).Implements(in.Type) {
+				in.Callback(plugins[i])
+			}
+		}
+	}
+}
+
+// respond returns the exec handler answering with the JSON encoded response, the requests sent to the worker are stored into requests
+func respond(response any, requests *[]events.APIGatewayV2HTTPRequest) execFunc {
+	var mu sync.Mutex
+
+	return func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		if requests != nil {
+			var request events.APIGatewayV2HTTPRequest
+			err := json.Unmarshal(pld.Body, &request)
+			if err != nil {
+				return nil, err
+			}
+
+			mu.Lock()
+			*requests = append(*requests, request)
+			mu.Unlock()
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+
+		return &payload.Payload{Body: body}, nil
+	}
+}
+
+func testContext() context.Context {
+	return lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: testRequestID})
+}
+
+// testRequest returns the API Gateway HTTP API (payload format 2.0) GET request
+func testRequest(path string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Version:  "2.0",
+		RouteKey: "$default",
+		RawPath:  path,
+		Headers:  map[string]string{"host": "example.com"},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			Stage:      "$default",
+			DomainName: "abc123.execute-api.us-east-1.amazonaws.com",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:   "GET",
+				Path:     path,
+				SourceIP: "203.0.113.7",
+			},
+		},
+	}
+}
+
+// serve sends the http request through the plugin
+func serve(t testing.TB, p *Plugin, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	event, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	return p.serveHTTP(testContext(), event, request)
+}
+
+// multipartBody returns the multipart/form-data body with the field and the file, and its content type
+func multipartBody(t testing.TB, field, file string) (string, string) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	require.NoError(t, mw.WriteField("name", field))
+
+	fw, err := mw.CreateFormFile("upload", "file.txt")
+	require.NoError(t, err)
+
+	_, err = fw.Write([]byte(file))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestServeStartsTheRuntimeWithTheEventHandler(t *testing.T) {
+	var result []byte
+	var errH error
+
+	p := &Plugin{}
+	// the fake runtime delivers a single event and exits
+	p.start = func(handler any) {
+		event, err := json.Marshal(testRequest("/users"))
+		require.NoError(t, err)
+
+		result, errH = lambda.NewHandler(handler).Invoke(testContext(), event)
+	}
+
+	var requests []events.APIGatewayV2HTTPRequest
+	setTestPools(t, p, respond(events.APIGatewayV2HTTPResponse{StatusCode: 201, Body: "created"}, &requests))
+
+	require.NoError(t, p.Init(&testConfigurer{cfg: &Config{Pool: &pool.Config{NumWorkers: 2}}}, nil, &testLogger{log: zap.NewNop()}))
+
+	err := <-p.Serve()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lambda runtime loop exited")
+	require.NoError(t, p.Stop(context.Background()))
+
+	require.NoError(t, errH)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/users", requests[0].RawPath)
+
+	var response events.APIGatewayV2HTTPResponse
+	require.NoError(t, json.Unmarshal(result, &response))
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, "created", response.Body)
+	assert.True(t, p.wrkPool.(*testPool).destroyed)
+}
+
+func BenchmarkInvoke(b *testing.B) {
+	p := &Plugin{}
+	newTestPlugin(b, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: `{"ok":true}`}, nil))
+
+	ctx := testContext()
+	request := testRequest("/users")
+	attrs := map[string]string{attrRequestID: testRequestID}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var response events.APIGatewayV2HTTPResponse
+		err := p.invoke(ctx, p.wrkPool, request, attrs, &response)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	p := &Plugin{}
+	newTestPlugin(b, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"content-type": "application/json"},
+		Body:       `{"id":1,"name":"test"}`,
+	}, nil))
+
+	get := testRequest("/users/1")
+	get.Headers["accept"] = "application/json"
+
+	urlencoded := testRequest("/users")
+	urlencoded.RequestContext.HTTP.Method = "POST"
+	urlencoded.Headers["content-type"] = "application/x-www-form-urlencoded"
+	urlencoded.Body = "name=test&tags=a&tags=b"
+
+	mp := testRequest("/uploads")
+	mp.RequestContext.HTTP.Method = "POST"
+	mp.Body, mp.Headers["content-type"] = multipartBody(b, "test", "small file content")
+
+	cases := []struct {
+		name    string
+		request events.APIGatewayV2HTTPRequest
+	}{
+		{name: "get_json", request: get},
+		{name: "post_urlencoded", request: urlencoded},
+		{name: "post_multipart", request: mp},
+	}
+
+	for _, tc := range cases {
+		event, err := json.Marshal(tc.request)
+		require.NoError(b, err)
+
+		b.Run(tc.name, func(b *testing.B) {
+			handler := p.handler()
+			ctx := testContext()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_, err := handler(ctx, event)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerErrorIsLoggedWithTheRequestID(t *testing.T) {
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		return nil, errors.E(errors.SoftJob, errors.Str("PHP Fatal error: Allowed memory size exhausted"))
+	})
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, 500, rsp.StatusCode)
+
+	entries := logs.FilterMessage("worker exec failed").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, testRequestID, entries[0].ContextMap()["request_id"])
+	assert.Contains(t, entries[0].ContextMap()["error"], "PHP Fatal error")
+}
+
+func TestPoolExhaustedReturns503(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "allocate timeout", err: errors.E(errors.NoFreeWorkers, errors.Str("no free workers in the pool")), want: 503},
+		{name: "queue size", err: errors.E(errors.QueueSize, errors.Str("max queue size reached")), want: 503},
+		{name: "other", err: errors.Str("worker crashed"), want: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+				return nil, tt.err
+			})
+
+			rsp := serve(t, p, testRequest("/users"))
+			assert.Equal(t, tt.want, rsp.StatusCode)
+			if tt.want == 503 {
+				assert.Equal(t, retryAfter, rsp.Headers["Retry-After"])
+			}
+		})
+	}
+}
+
+func TestWorkerErrorLeavesThePoolWorkers(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		return nil, errors.E(errors.Network, errors.Str("worker crashed"))
+	})
+
+	for range 3 {
+		rsp := serve(t, p, testRequest("/users"))
+		assert.Equal(t, 500, rsp.StatusCode)
+	}
+
+	// the pool replaces the failed worker itself, the healthy ones are never removed
+	tp := p.wrkPool.(*testPool)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	assert.Zero(t, tp.removed)
+	assert.Zero(t, tp.added)
+	assert.Len(t, tp.workers, int(tp.cfg.NumWorkers))
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	const limit = 2
+
+	entered := make(chan struct{}, limit)
+	release := make(chan struct{})
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{MaxConcurrency: limit}, func(ctx context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		entered <- struct{}{}
+		<-release
+		return respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil)(ctx, pld)
+	})
+
+	statuses := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() {
+			statuses <- serve(t, p, testRequest("/slow")).StatusCode
+		}()
+	}
+
+	for i := 0; i < limit; i++ {
+		<-entered
+	}
+
+	// all the slots are taken
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, 503, rsp.StatusCode)
+	assert.Equal(t, retryAfter, rsp.Headers["Retry-After"])
+
+	close(release)
+	for i := 0; i < limit; i++ {
+		assert.Equal(t, 200, <-statuses)
+	}
+
+	// the slots are freed
+	assert.Equal(t, 200, serve(t, p, testRequest("/users")).StatusCode)
+}
+
+func TestReady(t *testing.T) {
+	p := &Plugin{}
+	setTestPools(t, p, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+	assert.False(t, p.Ready())
+
+	startTestPlugin(t, p, &Config{})
+	assert.True(t, p.Ready())
+
+	// the pools are being created or reset, the probe doesn't wait
+	p.mu.Lock()
+	done := make(chan bool)
+	go func() {
+		done <- p.Ready()
+	}()
+
+	select {
+	case ready := <-done:
+		assert.False(t, ready)
+	case <-time.After(time.Second):
+		t.Fatal("Ready is blocked by the plugin lock")
+	}
+	p.mu.Unlock()
+	assert.True(t, p.Ready())
+
+	// the read locks (e.g. the reset sentinel check on every request) don't make it not ready
+	p.mu.RLock()
+	assert.True(t, p.Ready())
+	p.mu.RUnlock()
+
+	workers := p.wrkPool.Workers()
+	for i := 0; i < len(workers); i++ {
+		workers[i].State().Transition(fsm.StateStopped)
+	}
+	assert.False(t, p.Ready())
+}
+
+func TestWarmUpCreatesAllWorkers(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{Pool: &pool.Config{NumWorkers: 4}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	// the workers are ready as soon as Serve returns
+	assert.Len(t, p.wrkPool.Workers(), 4)
+	assert.True(t, p.Ready())
+}
+
+func TestWarmUpFailure(t *testing.T) {
+	var tp *testPool
+
+	p := &Plugin{}
+	p.poolFactory = func(_ context.Context, cfg *pool.Config, _ map[string]string) (Pool, error) {
+		assert.Equal(t, defaultAllocateTimeout, cfg.AllocateTimeout)
+
+		// one of the workers didn't boot in time
+		short := *cfg
+		short.NumWorkers--
+		tp = newTestPool(t, &short, nil)
+
+		return tp, nil
+	}
+
+	cfg := &Config{Pool: &pool.Config{NumWorkers: 4}}
+	require.NoError(t, p.Init(&testConfigurer{cfg: cfg}, nil, &testLogger{log: zap.NewNop()}))
+
+	err := <-p.Serve()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "workers warm-up failed: 3 of 4 workers are ready")
+	assert.True(t, tp.destroyed)
+	assert.False(t, p.Ready())
+}
+
+func TestTimeoutLateResponse(t *testing.T) {
+	const late = `{"statusCode":200,"body":"slow"}`
+
+	tests := []struct {
+		name    string
+		codec   string
+		include bool
+		want    string
+	}{
+		{name: "included", codec: codecJSON, include: true, want: "request timeout exceeded, late worker response:\n" + late},
+		{name: "disabled", codec: codecJSON, want: "request timeout exceeded"},
+		// the msgpack and proto responses are not readable
+		{name: "msgpack", codec: codecMsgpack, include: true, want: "request timeout exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{
+				Codec:          tt.codec,
+				RequestTimeout: time.Millisecond * 10,
+				Timeout:        TimeoutConfig{IncludeLateResponse: tt.include},
+			}, func(ctx context.Context, _ *payload.Payload) (*payload.Payload, error) {
+				// the response is completed after the deadline
+				<-ctx.Done()
+				return &payload.Payload{Body: []byte(late)}, nil
+			})
+
+			rsp := serve(t, p, testRequest("/slow"))
+			assert.Equal(t, http.StatusGatewayTimeout, rsp.StatusCode)
+			assert.Equal(t, tt.want, rsp.Body)
+		})
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(any)
+		pool  func(context.Context, *pool.Config, map[string]string) (Pool, error)
+		want  string
+	}{
+		{name: "runtime exited", start: func(any) {}, want: "lambda runtime loop exited"},
+		{name: "runtime panic", start: func(any) { panic("runtime API unavailable") }, want: "lambda runtime panic: runtime API unavailable"},
+		{
+			name:  "pool error",
+			start: func(any) { t.Error("the runtime should not be started") },
+			pool: func(context.Context, *pool.Config, map[string]string) (Pool, error) {
+				return nil, errors.Str("php not found")
+			},
+			want: "php not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{start: tt.start}
+			setTestPools(t, p, nil)
+			if tt.pool != nil {
+				p.poolFactory = tt.pool
+			}
+
+			require.NoError(t, p.Init(&testConfigurer{cfg: &Config{}}, nil, &testLogger{log: zap.NewNop()}))
+
+			select {
+			case err := <-p.Serve():
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.want)
+			case <-time.After(time.Second):
+				t.Fatal("no error from Serve")
+			}
+
+			require.NoError(t, p.Stop(context.Background()))
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// the remaining lambda time
+		deadline time.Duration
+		fn       execFunc
+	}{
+		{
+			name:    "slow worker",
+			timeout: time.Millisecond * 20,
+			fn: func(ctx context.Context, _ *payload.Payload) (*payload.Payload, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+		{
+			name:    "exec ttl",
+			timeout: time.Second,
+			fn: func(context.Context, *payload.Payload) (*payload.Payload, error) {
+				return nil, errors.E(errors.ExecTTL, errors.Str("worker exec ttl exceeded"))
+			},
+		},
+		{
+			name:     "capped by the lambda deadline",
+			timeout:  time.Minute,
+			deadline: time.Millisecond * 20,
+			fn: func(ctx context.Context, _ *payload.Payload) (*payload.Payload, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{RequestTimeout: tt.timeout}, tt.fn)
+
+			ctx := testContext()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			start := time.Now()
+			event, err := json.Marshal(testRequest("/slow"))
+			require.NoError(t, err)
+
+			rsp := p.serveHTTP(ctx, event, testRequest("/slow"))
+			assert.Equal(t, http.StatusGatewayTimeout, rsp.StatusCode)
+			assert.Equal(t, "request timeout exceeded", rsp.Body)
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
+
+func TestRequestTimeoutExecTTL(t *testing.T) {
+	var cfgs []*pool.Config
+
+	p := &Plugin{}
+	setTestPools(t, p, nil)
+	p.poolFactory = func(_ context.Context, cfg *pool.Config, _ map[string]string) (Pool, error) {
+		cfgs = append(cfgs, cfg)
+		return newTestPool(t, cfg, nil), nil
+	}
+
+	supervisor := &pool.SupervisorConfig{MaxWorkerMemory: 128}
+	startTestPlugin(t, p, &Config{RequestTimeout: time.Second * 10, Pool: &pool.Config{NumWorkers: 1, Supervisor: supervisor}})
+
+	// the pool kills the worker exceeding the request timeout
+	require.Len(t, cfgs, 1)
+	assert.Equal(t, time.Second*10, cfgs[0].Supervisor.ExecTTL)
+	assert.Equal(t, uint64(128), cfgs[0].Supervisor.MaxWorkerMemory)
+	// the configured supervisor is not modified
+	assert.Zero(t, supervisor.ExecTTL)
+}
+
+func TestName(t *testing.T) {
+	// the name is also the config section key
+	assert.Equal(t, "lambda", (&Plugin{}).Name())
+}
+
+func TestEncodeFailure(t *testing.T) {
+	tests := []struct {
+		codec string
+		event any
+	}{
+		{codec: codecJSON, event: map[string]any{"ch": make(chan int)}},
+		{codec: codecMsgpack, event: map[string]any{"ch": make(chan int)}},
+		{codec: codecProto, event: json.RawMessage(`{"truncated":`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			executed := false
+			p := &Plugin{}
+			logs := newTestPlugin(t, p, &Config{Codec: tt.codec}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+				executed = true
+				return &payload.Payload{}, nil
+			})
+
+			var out events.APIGatewayV2HTTPResponse
+			err := p.invoke(testContext(), p.wrkPool, tt.event, map[string]string{}, &out)
+			require.Error(t, err)
+			assert.False(t, executed)
+
+			entries := logs.FilterMessage("failed to encode the event").All()
+			require.Len(t, entries, 1)
+			assert.Equal(t, testRequestID, entries[0].ContextMap()["request_id"])
+
+			// the encoding details are not sent to the client
+			assert.Equal(t, events.APIGatewayV2HTTPResponse{StatusCode: http.StatusInternalServerError}, errorResponse(err))
+		})
+	}
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration
+		want      bool
+	}{
+		{name: "slow", threshold: time.Millisecond * 10, delay: time.Millisecond * 50, want: true},
+		{name: "fast", threshold: time.Second, delay: 0},
+		{name: "disabled", threshold: 0, delay: time.Millisecond * 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			reply := respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil)
+			logs := newTestPlugin(t, p, &Config{SlowThreshold: tt.threshold}, func(ctx context.Context, pld *payload.Payload) (*payload.Payload, error) {
+				time.Sleep(tt.delay)
+				return reply(ctx, pld)
+			})
+
+			ctx, cancel := context.WithTimeout(testContext(), time.Minute)
+			defer cancel()
+
+			request := testRequest("/reports")
+			request.RawQueryString = "year=2024"
+			event, err := json.Marshal(request)
+			require.NoError(t, err)
+
+			rsp := p.serveHTTP(ctx, event, request)
+			assert.Equal(t, 200, rsp.StatusCode)
+
+			entries := logs.FilterMessage("slow request").All()
+			if !tt.want {
+				assert.Empty(t, entries)
+				return
+			}
+
+			require.Len(t, entries, 1)
+			assert.Equal(t, zap.WarnLevel, entries[0].Level)
+			fields := entries[0].ContextMap()
+			assert.Equal(t, testRequestID, fields["request_id"])
+			assert.Equal(t, http.MethodGet, fields["method"])
+			assert.Equal(t, "/reports?year=2024", fields["uri"])
+			assert.GreaterOrEqual(t, fields["elapsed"], tt.delay)
+			assert.Greater(t, fields["remaining"], time.Second*50)
+		})
+	}
+}
+
+func TestCheckMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		supervisor *pool.SupervisorConfig
+		fnMemory   string
+		wantInfo   bool
+		wantWarn   bool
+	}{
+		{name: "no supervisor", fnMemory: "512"},
+		{name: "no memory limit", supervisor: &pool.SupervisorConfig{}, fnMemory: "512"},
+		{name: "fits", supervisor: &pool.SupervisorConfig{MaxWorkerMemory: 128}, fnMemory: "1024", wantInfo: true},
+		{name: "exceeds", supervisor: &pool.SupervisorConfig{MaxWorkerMemory: 128}, fnMemory: "512", wantInfo: true, wantWarn: true},
+		{name: "unknown function memory", supervisor: &pool.SupervisorConfig{MaxWorkerMemory: 128}, fnMemory: "", wantInfo: true},
+		{name: "invalid function memory", supervisor: &pool.SupervisorConfig{MaxWorkerMemory: 128}, fnMemory: "1GB", wantInfo: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", tt.fnMemory)
+
+			p := &Plugin{}
+			// 2 workers in the default and in the route pool
+			logs := newTestPlugin(t, p, &Config{
+				Pool:   &pool.Config{NumWorkers: 2, Supervisor: tt.supervisor},
+				Routes: []*Route{{Prefix: "/admin", Command: []string{"php", "admin.php"}}},
+			}, nil)
+
+			info := logs.FilterMessage("workers exceeding the memory limit are recycled").All()
+			warn := logs.FilterMessage("workers memory limit exceeds the function memory, lambda may kill the container before the workers are recycled").All()
+
+			if !tt.wantInfo {
+				assert.Empty(t, info)
+			} else {
+				require.Len(t, info, 1)
+				assert.Equal(t, zap.InfoLevel, info[0].Level)
+				assert.Equal(t, uint64(128), info[0].ContextMap()["max_worker_memory_mb"])
+				assert.Equal(t, uint64(4), info[0].ContextMap()["workers"])
+			}
+
+			if !tt.wantWarn {
+				assert.Empty(t, warn)
+				return
+			}
+
+			require.Len(t, warn, 1)
+			assert.Equal(t, zap.WarnLevel, warn[0].Level)
+			assert.Equal(t, uint64(4), warn[0].ContextMap()["workers"])
+			assert.Equal(t, uint64(512), warn[0].ContextMap()["function_memory_mb"])
+		})
+	}
+}
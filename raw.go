@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+)
+
+// rawHandler passes any JSON event to the worker as is and returns the worker response as the function result
+// (not re-encoded with the json codec). Worker errors are returned as the function errors
+func (p *Plugin) rawHandler() func(ctx context.Context, event json.RawMessage) (any, error) {
+	return func(ctx context.Context, event json.RawMessage) (any, error) {
+		const op = errors.Op("lambda_raw_handler")
+
+		if !p.acquire() {
+			return nil, errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+		attrs[attrRequestID] = requestID(ctx)
+
+		// the JSON worker response becomes the function result as is
+		if p.cfg.Codec == codecJSON {
+			var out json.RawMessage
+			err := p.invoke(ctx, p.wrkPool, event, attrs, &out)
+			if err != nil {
+				return nil, errors.E(op, err)
+			}
+
+			return out, nil
+		}
+
+		var out any
+		err := p.invoke(ctx, p.wrkPool, event, attrs, &out)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		return out, nil
+	}
+}
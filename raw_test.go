@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawHandlerRoundTrip(t *testing.T) {
+	event := `{"task":"resize","input":{"width":100,"tags":["a","b"]},"token":null}`
+
+	for _, codec := range []string{codecJSON, codecMsgpack} {
+		t.Run(codec, func(t *testing.T) {
+			var attrs map[string]string
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{Codec: codec, EventType: eventTypeRaw}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+				require.NoError(t, p.decode(pld.Context, &attrs))
+
+				// the worker echoes the event
+				return &payload.Payload{Body: pld.Body}, nil
+			})
+
+			out, err := lambda.NewHandler(p.rawHandler()).Invoke(testContext(), []byte(event))
+			require.NoError(t, err)
+			assert.JSONEq(t, event, string(out))
+			assert.Equal(t, testRequestID, attrs[attrRequestID])
+		})
+	}
+}
+
+func TestRawHandlerWorkerError(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeRaw}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		return nil, errors.Str("worker failed")
+	})
+
+	_, err := lambda.NewHandler(p.rawHandler()).Invoke(testContext(), []byte(`{"a":1}`))
+	assert.Error(t, err)
+}
+
+func TestRawHandlerKeepsTheWorkerJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{name: "key order", response: `{"z":1,"a":2,"m":{"y":true,"b":false}}`},
+		{name: "number precision", response: `{"id":12345678901234567890,"amount":0.10000000000000000555}`},
+		{name: "array", response: `[1,"two",null]`},
+		{name: "scalar", response: `"done"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{EventType: eventTypeRaw}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+				return &payload.Payload{Body: []byte(tt.response)}, nil
+			})
+
+			out, err := lambda.NewHandler(p.rawHandler()).Invoke(testContext(), []byte(`{}`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.response, string(out))
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// prepareRequest normalizes the incoming event before it is sent to the worker,
+// statusError is returned when the request should be rejected
+func (p *Plugin) prepareRequest(request *events.APIGatewayV2HTTPRequest) error {
+	// direct invocations may omit the headers, the worker should always get an object rather than null
+	if request.Headers == nil {
+		request.Headers = make(map[string]string)
+	}
+
+	if !p.headersWithinLimits(request) {
+		return newStatusError(http.StatusRequestHeaderFieldsTooLarge, "request headers are too large")
+	}
+
+	// the same as the reverse proxies do
+	if !p.cfg.KeepHopByHopHeaders {
+		removeHopByHop(request.Headers)
+	}
+
+	// the token was already validated by the API Gateway authorizer, its claims are in the request context
+	if p.cfg.StripAuthorization && request.RequestContext.Authorizer != nil {
+		delHeader(request.Headers, "authorization")
+	}
+
+	// the body is already delivered, the worker must not wait for the continuation
+	if strings.EqualFold(strings.TrimSpace(getHeader(request.Headers, "expect")), "100-continue") {
+		delHeader(request.Headers, "expect")
+	}
+
+	// checked before anything is decoded
+	if p.cfg.MaxBodySize > 0 && bodySize(request) > p.cfg.MaxBodySize {
+		return newStatusError(http.StatusRequestEntityTooLarge, "request body is too large")
+	}
+
+	// some integrations only populate the decoded query parameters map
+	if request.RawQueryString == "" && len(request.QueryStringParameters) > 0 {
+		request.RawQueryString = rawQuery(request.QueryStringParameters)
+	}
+
+	if p.cfg.DecodePath {
+		// keep the raw path when it is not a valid escape sequence
+		path, err := url.PathUnescape(request.RawPath)
+		if err != nil {
+			p.log.Debug("failed to decode the request path", zap.String("path", request.RawPath), zap.Error(err))
+		} else {
+			request.RawPath = path
+		}
+	}
+
+	p.normalizePath(request)
+
+	p.setForwardedHost(request)
+	p.setForwarded(request)
+
+	if p.cfg.DecompressRequest {
+		err := decompressBody(request, p.cfg.MaxBodySize)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := validateMultipart(p.log, request, p.cfg.Uploads.MaxParts)
+	if err != nil {
+		return err
+	}
+
+	// text bodies are decoded, so the worker receives them as is. Other types missing from binary_media_types
+	// (multipart, octet-stream) and the invalid UTF-8 stay encoded, the JSON payload would corrupt them
+	ct := getHeader(request.Headers, "content-type")
+	if request.IsBase64Encoded && len(p.cfg.BinaryMediaTypes) > 0 && !p.isBinary(ct) && isText(ct) {
+		body, err := decodeBase64(request.Body)
+		switch {
+		case err != nil:
+			p.log.Debug("failed to decode the base64 request body", zap.Error(err))
+		case !utf8.Valid(body):
+			p.log.Debug("the base64 request body is not valid UTF-8, it is kept encoded")
+		default:
+			request.Body = string(body)
+			request.IsBase64Encoded = false
+		}
+	}
+
+	if p.cfg.ValidateJSON && mediaType(getHeader(request.Headers, "content-type")) == "application/json" {
+		err = validateJSON(request)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// headersWithinLimits checks the request headers and cookies against the max_headers and max_header_bytes limits,
+// the negative limits are disabled
+func (p *Plugin) headersWithinLimits(request *events.APIGatewayV2HTTPRequest) bool {
+	if p.cfg.MaxHeaders > 0 && len(request.Headers)+len(request.Cookies) > p.cfg.MaxHeaders {
+		return false
+	}
+
+	if p.cfg.MaxHeaderBytes < 0 {
+		return true
+	}
+
+	size := 0
+	for k, v := range request.Headers {
+		size += len(k) + len(v)
+	}
+
+	for i := 0; i < len(request.Cookies); i++ {
+		size += len(request.Cookies[i])
+	}
+
+	return size <= p.cfg.MaxHeaderBytes
+}
+
+// validateJSON rejects the malformed JSON bodies, empty bodies are allowed
+func validateJSON(request *events.APIGatewayV2HTTPRequest) error {
+	if request.Body == "" {
+		return nil
+	}
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		var err error
+		body, err = decodeBase64(request.Body)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid base64 body")
+		}
+	}
+
+	if !json.Valid(body) {
+		return newStatusError(http.StatusBadRequest, "invalid JSON body")
+	}
+
+	return nil
+}
+
+// decompressBody decodes the body according to the Content-Encoding header and removes the header
+func decompressBody(request *events.APIGatewayV2HTTPRequest, limit int64) error {
+	encoding := getHeader(request.Headers, "content-encoding")
+	if encoding == "" || request.Body == "" {
+		return nil
+	}
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		var err error
+		body, err = decodeBase64(request.Body)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid base64 body")
+		}
+	}
+
+	body, err := decodeBody(encoding, body, limit)
+	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) {
+			return err
+		}
+
+		return newStatusError(http.StatusBadRequest, "invalid "+encoding+" body")
+	}
+
+	// keep binary data base64 encoded
+	if request.IsBase64Encoded {
+		request.Body = base64.StdEncoding.EncodeToString(body)
+	} else {
+		request.Body = string(body)
+	}
+
+	delHeader(request.Headers, "content-encoding")
+	delHeader(request.Headers, "content-length")
+
+	return nil
+}
+
+// normalizePath reconciles the request path with the stage and the custom domain base path mapping,
+// so the same route has the same path for the execute-api (/prod/users) and the custom domain (/api/users) URLs:
+// the configured base_path prefix is removed first, otherwise the named stage segment (strip_stage).
+// The removed prefix is sent in the X-Forwarded-Prefix header, so the worker can still generate the public URLs
+func (p *Plugin) normalizePath(request *events.APIGatewayV2HTTPRequest) {
+	var prefix string
+	stage := request.RequestContext.Stage
+
+	switch {
+	case p.cfg.BasePath != "" && matchPrefix(request.RawPath, p.cfg.BasePath):
+		prefix = p.cfg.BasePath
+	case p.cfg.StripStage && stage != "" && stage != "$default" && matchPrefix(request.RawPath, "/"+stage):
+		prefix = "/" + stage
+	default:
+		return
+	}
+
+	request.RawPath = request.RawPath[len(prefix):]
+	if request.RawPath == "" {
+		request.RawPath = "/"
+	}
+
+	if getHeader(request.Headers, "x-forwarded-prefix") == "" {
+		request.Headers["x-forwarded-prefix"] = prefix
+	}
+}
+
+// rawQuery builds the URL-encoded query string (sorted by key) from the decoded query parameters.
+// API Gateway joins the repeated parameters with commas (tag=a&tag=b -> tag=a,b), such values are split back
+// into the repeated parameters, so a literal comma in a single value can't be told apart
+func rawQuery(params map[string]string) string {
+	values := make(url.Values, len(params))
+	for k, v := range params {
+		values[k] = strings.Split(v, ",")
+	}
+
+	return values.Encode()
+}
+
+// bodySize returns the size of the decoded request body, base64 bodies are not decoded to compute it
+func bodySize(request *events.APIGatewayV2HTTPRequest) int64 {
+	if !request.IsBase64Encoded {
+		return int64(len(request.Body))
+	}
+
+	// the padding doesn't carry any data, both padded and unpadded bodies are accepted
+	return int64(base64.RawStdEncoding.DecodedLen(len(strings.TrimRight(request.Body, "="))))
+}
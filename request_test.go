@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   string
+	}{
+		{name: "empty", params: map[string]string{}, want: ""},
+		{name: "sorted by key", params: map[string]string{"b": "2", "a": "1"}, want: "a=1&b=2"},
+		{name: "escaped", params: map[string]string{"q": "a b/c?", "k&": "="}, want: "k%26=%3D&q=a+b%2Fc%3F"},
+		{name: "empty value", params: map[string]string{"flag": ""}, want: "flag="},
+		// API Gateway joins the repeated parameters with commas
+		{name: "multi-value", params: map[string]string{"tag": "a,b,c", "page": "1"}, want: "page=1&tag=a&tag=b&tag=c"},
+		{name: "empty multi-value items", params: map[string]string{"tag": "a,,b"}, want: "tag=a&tag=&tag=b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rawQuery(tt.params))
+		})
+	}
+}
+
+func TestRawQueryFallback(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+	request := testRequest("/search")
+	request.QueryStringParameters = map[string]string{"q": "a b&c", "page": "2"}
+
+	rsp := serve(t, p, request)
+	assert.Equal(t, 200, rsp.StatusCode)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "page=2&q=a+b%26c", requests[0].RawQueryString)
+
+	// the raw query string sent by API Gateway is kept
+	request.RawQueryString = "q=raw"
+	serve(t, p, request)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "q=raw", requests[1].RawQueryString)
+}
+
+func TestDecodePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode bool
+		path   string
+		want   string
+	}{
+		{name: "raw encoded slash", path: "/files/a%2Fb", want: "/files/a%2Fb"},
+		{name: "raw space", path: "/files/a%20b", want: "/files/a%20b"},
+		{name: "decoded slash", decode: true, path: "/files/a%2Fb", want: "/files/a/b"},
+		{name: "decoded space", decode: true, path: "/files/a%20b", want: "/files/a b"},
+		{name: "invalid escape kept", decode: true, path: "/files/a%zzb", want: "/files/a%zzb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{DecodePath: tt.decode}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			serve(t, p, testRequest(tt.path))
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, requests[0].RawPath)
+		})
+	}
+}
+
+func BenchmarkPrepareRequest(b *testing.B) {
+	p := &Plugin{}
+	newTestPlugin(b, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		request := testRequest("/users")
+		request.Headers["content-type"] = "application/json"
+		request.Headers["connection"] = "keep-alive"
+		request.QueryStringParameters = map[string]string{"page": "1", "tag": "a,b"}
+		request.Body = `{"name":"test"}`
+
+		err := p.prepareRequest(&request)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyRequest(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{ValidateJSON: true, DecompressRequest: true}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 204}, &requests))
+
+	for _, event := range []string{`{}`, `{"headers":null,"body":""}`} {
+		rsp, err := p.handler()(testContext(), json.RawMessage(event))
+		require.NoError(t, err, event)
+		assert.Equal(t, 204, rsp.(events.APIGatewayV2HTTPResponse).StatusCode, event)
+	}
+
+	// the worker gets an object rather than null
+	require.Len(t, requests, 2)
+	for i := 0; i < len(requests); i++ {
+		assert.NotNil(t, requests[i].Headers)
+	}
+}
+
+func TestBodySize(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 100, 101, 102} {
+		body := strings.Repeat("a", n)
+		encoded := base64.StdEncoding.EncodeToString([]byte(body))
+
+		assert.Equal(t, int64(n), bodySize(&events.APIGatewayV2HTTPRequest{Body: body}), n)
+		assert.Equal(t, int64(n), bodySize(&events.APIGatewayV2HTTPRequest{Body: encoded, IsBase64Encoded: true}), n)
+		assert.Equal(t, int64(n), bodySize(&events.APIGatewayV2HTTPRequest{Body: strings.TrimRight(encoded, "="), IsBase64Encoded: true}), n)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		base64 bool
+		status int
+	}{
+		{name: "at the limit", size: 100, status: http.StatusOK},
+		{name: "over the limit", size: 101, status: http.StatusRequestEntityTooLarge},
+		// the encoded body is larger than the limit, the decoded one is not
+		{name: "base64 at the limit", size: 100, base64: true, status: http.StatusOK},
+		{name: "base64 over the limit", size: 101, base64: true, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{MaxBodySize: 100}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/upload")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Body = strings.Repeat("a", tt.size)
+			if tt.base64 {
+				request.Body = base64.StdEncoding.EncodeToString([]byte(request.Body))
+				request.IsBase64Encoded = true
+			}
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+			assert.Equal(t, tt.status == http.StatusOK, len(requests) == 1)
+		})
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		contentType string
+		body        string
+		base64      bool
+		status      int
+	}{
+		{name: "valid", enabled: true, contentType: "application/json", body: `{"name":"test"}`, status: http.StatusOK},
+		{name: "invalid", enabled: true, contentType: "application/json", body: `{"name":`, status: http.StatusBadRequest},
+		{name: "invalid with charset", enabled: true, contentType: "application/json; charset=utf-8", body: `{"name":`, status: http.StatusBadRequest},
+		{name: "valid base64", enabled: true, contentType: "application/json", body: `[1,2]`, base64: true, status: http.StatusOK},
+		{name: "invalid base64", enabled: true, contentType: "application/json", body: `[1,`, base64: true, status: http.StatusBadRequest},
+		{name: "empty", enabled: true, contentType: "application/json", status: http.StatusOK},
+		{name: "other content type", enabled: true, contentType: "text/plain", body: `{"name":`, status: http.StatusOK},
+		{name: "disabled", contentType: "application/json", body: `{"name":`, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{ValidateJSON: tt.enabled}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/users")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Headers["content-type"] = tt.contentType
+			request.Body = tt.body
+			if tt.base64 {
+				request.Body = base64.StdEncoding.EncodeToString([]byte(tt.body))
+				request.IsBase64Encoded = true
+			}
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+
+			// the invalid bodies don't reach the worker
+			assert.Equal(t, tt.status == http.StatusOK, len(requests) == 1)
+		})
+	}
+}
+
+func TestHeaderLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxCount  int
+		maxBytes  int
+		headers   int
+		cookies   int
+		valueSize int
+		status    int
+	}{
+		{name: "within the limits", maxCount: 10, maxBytes: 1024, headers: 5, cookies: 4, valueSize: 10, status: http.StatusOK},
+		{name: "too many headers", maxCount: 10, maxBytes: 1024, headers: 11, valueSize: 1, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "cookies are counted", maxCount: 10, maxBytes: 1024, headers: 5, cookies: 6, valueSize: 1, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "too large", maxCount: 10, maxBytes: 1024, headers: 2, valueSize: 1024, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "defaults", headers: 500, valueSize: 100, status: http.StatusOK},
+		{name: "default count exceeded", headers: 1001, valueSize: 1, status: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "unlimited", maxCount: -1, maxBytes: -1, headers: 2000, cookies: 100, valueSize: 1024, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{MaxHeaders: tt.maxCount, MaxHeaderBytes: tt.maxBytes}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, &requests))
+
+			request := testRequest("/users")
+			request.Headers = make(map[string]string, tt.headers)
+			for i := 0; i < tt.headers; i++ {
+				request.Headers["x-header-"+strconv.Itoa(i)] = strings.Repeat("v", tt.valueSize)
+			}
+			for i := 0; i < tt.cookies; i++ {
+				request.Cookies = append(request.Cookies, "c"+strconv.Itoa(i)+"="+strings.Repeat("v", tt.valueSize))
+			}
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+
+			// rejected before reaching the worker
+			assert.Equal(t, tt.status == http.StatusOK, len(requests) == 1)
+		})
+	}
+}
+
+func TestRawQueryFallbackMultiValue(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+	request := testRequest("/search")
+	request.QueryStringParameters = map[string]string{"tag": "a,b"}
+
+	serve(t, p, request)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "tag=a&tag=b", requests[0].RawQueryString)
+}
+
+func TestStripStage(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   bool
+		stage      string
+		path       string
+		prefix     string
+		wantPath   string
+		wantPrefix string
+	}{
+		{name: "named stage", stage: "prod", path: "/prod/users", wantPath: "/users", wantPrefix: "/prod"},
+		{name: "stage root", stage: "prod", path: "/prod", wantPath: "/", wantPrefix: "/prod"},
+		{name: "default stage", stage: "$default", path: "/prod/users", wantPath: "/prod/users"},
+		{name: "path without the stage", stage: "prod", path: "/users", wantPath: "/users"},
+		{name: "stage name prefix", stage: "prod", path: "/production/users", wantPath: "/production/users"},
+		{name: "client prefix kept", stage: "prod", path: "/prod/users", prefix: "/api", wantPath: "/users", wantPrefix: "/api"},
+		{name: "disabled", disabled: true, stage: "prod", path: "/prod/users", wantPath: "/prod/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{StripStage: !tt.disabled}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest(tt.path)
+			request.RequestContext.Stage = tt.stage
+			if tt.prefix != "" {
+				request.Headers["x-forwarded-prefix"] = tt.prefix
+			}
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, 200, rsp.StatusCode)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.wantPath, requests[0].RawPath)
+			assert.Equal(t, tt.wantPrefix, getHeader(requests[0].Headers, "x-forwarded-prefix"))
+		})
+	}
+}
+
+func TestStripStageSelectsThePool(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{
+		StripStage: true,
+		Routes:     []*Route{{Prefix: "/admin", Command: []string{"php", "admin.php"}}},
+	}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	var selected []string
+	execPayload := p.execPayload
+	p.execPayload = func(ctx context.Context, wp Pool, pld *payload.Payload) (*payload.Payload, error) {
+		selected = wp.(*testPool).cfg.Command
+		return execPayload(ctx, wp, pld)
+	}
+
+	request := testRequest("/prod/admin/users")
+	request.RequestContext.Stage = "prod"
+	serve(t, p, request)
+
+	assert.Equal(t, []string{"php", "admin.php"}, selected)
+}
+
+func TestExpectContinueRemoved(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "lower case", headers: map[string]string{"expect": "100-continue"}},
+		{name: "canonical", headers: map[string]string{"Expect": "100-Continue"}},
+		{name: "padded", headers: map[string]string{"expect": " 100-continue "}},
+		{name: "other expectation", headers: map[string]string{"expect": "custom"}, want: "custom"},
+		{name: "none", headers: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/upload")
+			request.RequestContext.HTTP.Method = http.MethodPost
+			request.Body = "data"
+			for k, v := range tt.headers {
+				request.Headers[k] = v
+			}
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, getHeader(requests[0].Headers, "expect"))
+			assert.Equal(t, "data", requests[0].Body)
+		})
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		basePath   string
+		stripStage bool
+		stage      string
+		path       string
+		wantPath   string
+		wantPrefix string
+	}{
+		{name: "custom domain", basePath: "/api", stage: "prod", path: "/api/users", wantPath: "/users", wantPrefix: "/api"},
+		{name: "mapping root", basePath: "/api", stage: "prod", path: "/api", wantPath: "/", wantPrefix: "/api"},
+		{name: "normalized base path", basePath: "api/v1/", stage: "prod", path: "/api/v1/users", wantPath: "/users", wantPrefix: "/api/v1"},
+		{name: "root base path", basePath: "/", stage: "prod", path: "/users", wantPath: "/users"},
+		{name: "segment aware", basePath: "/api", stage: "prod", path: "/apis/users", wantPath: "/apis/users"},
+		// the execute-api and the custom domain URLs reach the worker as the same path
+		{name: "execute-api with strip_stage", basePath: "/api", stripStage: true, stage: "prod", path: "/prod/users", wantPath: "/users", wantPrefix: "/prod"},
+		{name: "custom domain with strip_stage", basePath: "/api", stripStage: true, stage: "prod", path: "/api/users", wantPath: "/users", wantPrefix: "/api"},
+		{name: "base path first", basePath: "/prod", stripStage: true, stage: "prod", path: "/prod/users", wantPath: "/users", wantPrefix: "/prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{BasePath: tt.basePath, StripStage: tt.stripStage}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest(tt.path)
+			request.RequestContext.Stage = tt.stage
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.wantPath, requests[0].RawPath)
+			assert.Equal(t, tt.wantPrefix, getHeader(requests[0].Headers, "x-forwarded-prefix"))
+		})
+	}
+}
+
+func TestStripAuthorization(t *testing.T) {
+	jwt := &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "user-1"}},
+	}
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription
+		want       string
+	}{
+		{name: "validated by the authorizer", enabled: true, authorizer: jwt, want: ""},
+		{name: "no authorizer", enabled: true, want: "Bearer token"},
+		{name: "disabled", enabled: false, authorizer: jwt, want: "Bearer token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []events.APIGatewayV2HTTPRequest
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{StripAuthorization: tt.enabled}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+			request := testRequest("/me")
+			request.Headers["Authorization"] = "Bearer token"
+			request.RequestContext.Authorizer = tt.authorizer
+
+			serve(t, p, request)
+			require.Len(t, requests, 1)
+			assert.Equal(t, tt.want, getHeader(requests[0].Headers, "authorization"))
+			if tt.authorizer != nil {
+				// the worker still gets the claims
+				require.NotNil(t, requests[0].RequestContext.Authorizer)
+				assert.Equal(t, "user-1", requests[0].RequestContext.Authorizer.JWT.Claims["sub"])
+			}
+		})
+	}
+}
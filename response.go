@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// statusReasonHeader lets the worker communicate the reason phrase, the header is logged and not sent to the client
+const statusReasonHeader string = "X-Status-Reason"
+
+// prepareResponse post-processes the worker response before it is returned to the lambda runtime
+func (p *Plugin) prepareResponse(ctx context.Context, request *events.APIGatewayV2HTTPRequest, response *events.APIGatewayV2HTTPResponse) {
+	response.StatusCode = p.workerStatus(ctx, response.StatusCode)
+
+	// RFC 9110: 1xx, 204 and 304 responses never have a body
+	if noBody(response.StatusCode) {
+		response.Body = ""
+		response.IsBase64Encoded = false
+		delHeader(response.Headers, "content-length")
+	} else if response.Body == "" && request.RequestContext.HTTP.Method != http.MethodHead && getHeader(response.Headers, "content-length") != "0" {
+		// the stale length of the body the worker didn't send, HEAD responses keep the length of the GET body
+		delHeader(response.Headers, "content-length")
+	}
+
+	// the worker may send the same header in different cases
+	response.Headers = canonicalHeaders(response.Headers)
+
+	// API Gateway v2 has no reason phrase, the worker's one is only logged
+	if reason, ok := response.Headers[statusReasonHeader]; ok {
+		p.log.Info("worker status reason",
+			zap.String("request_id", requestID(ctx)),
+			zap.Int("status", response.StatusCode),
+			zap.String("reason", reason),
+		)
+		delete(response.Headers, statusReasonHeader)
+	}
+
+	// API Gateway v2 expects the cookies in the dedicated field, the values are passed as is to keep the attributes
+	if cookie, ok := response.Headers["Set-Cookie"]; ok {
+		for _, c := range strings.Split(cookie, "\n") {
+			if c = strings.TrimSpace(c); c != "" {
+				response.Cookies = append(response.Cookies, c)
+			}
+		}
+
+		delete(response.Headers, "Set-Cookie")
+	}
+
+	// the redirect must have a single target, relative references are passed as is (RFC 7231)
+	if location, ok := response.Headers["Location"]; ok {
+		first, rest, multiple := strings.Cut(location, "\n")
+		if multiple {
+			p.log.Warn("multiple Location values, the first one is used",
+				zap.String("request_id", requestID(ctx)),
+				zap.String("ignored", rest),
+			)
+		}
+
+		response.Headers["Location"] = strings.TrimSpace(first)
+	}
+
+	// API Gateway would default to application/json otherwise
+	if p.cfg.DefaultContentType != "" && response.Body != "" && getHeader(response.Headers, "content-type") == "" {
+		if response.Headers == nil {
+			response.Headers = make(map[string]string, 1)
+		}
+
+		response.Headers["Content-Type"] = p.cfg.DefaultContentType
+	}
+
+	// binary bodies must be base64 encoded for API Gateway to decode them,
+	// the body compressed by the worker is binary regardless of the content type
+	if !response.IsBase64Encoded && response.Body != "" && (p.cfg.BinarySafe || p.isBinary(getHeader(response.Headers, "content-type")) || contentEncoded(getHeader(response.Headers, "content-encoding"))) {
+		response.Body = base64.StdEncoding.EncodeToString([]byte(response.Body))
+		response.IsBase64Encoded = true
+	}
+
+	p.compress(request, response)
+
+	if p.cfg.PoweredBy && getHeader(response.Headers, "x-powered-by") == "" {
+		if response.Headers == nil {
+			response.Headers = make(map[string]string, 1)
+		}
+
+		response.Headers["X-Powered-By"] = poweredBy()
+	}
+}
+
+// responseHeaders merges the configured response headers into the response headers,
+// the interceptors may set the headers in any case, so they are canonicalized first
+func (p *Plugin) responseHeaders(response *events.APIGatewayV2HTTPResponse) {
+	if len(p.cfg.ResponseHeaders) == 0 {
+		return
+	}
+
+	response.Headers = canonicalHeaders(response.Headers)
+	if response.Headers == nil {
+		response.Headers = make(map[string]string, len(p.cfg.ResponseHeaders))
+	}
+
+	for k, v := range p.cfg.ResponseHeaders {
+		// the config keys are lowercased by the config plugin
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := response.Headers[ck]; ok && !p.cfg.ResponseHeadersOverride {
+			continue
+		}
+
+		response.Headers[ck] = v
+	}
+}
+
+// checkResponseSize returns 502 for the responses exceeding the max_response_size or max_response_header_bytes,
+// which API Gateway would reject with an opaque error
+func (p *Plugin) checkResponseSize(ctx context.Context, response *events.APIGatewayV2HTTPResponse) error {
+	headerBytes := 0
+	for k, v := range response.Headers {
+		headerBytes += len(k) + len(v)
+	}
+
+	for i := 0; i < len(response.Cookies); i++ {
+		headerBytes += len(response.Cookies[i])
+	}
+
+	if p.cfg.MaxResponseHeaderBytes > 0 && headerBytes > p.cfg.MaxResponseHeaderBytes {
+		p.log.Error("worker response headers are too large", zap.String("request_id", requestID(ctx)), zap.Int("size", headerBytes), zap.Int("limit", p.cfg.MaxResponseHeaderBytes))
+		return newStatusError(http.StatusBadGateway, "response headers are too large")
+	}
+
+	if size := len(response.Body) + headerBytes; p.cfg.MaxResponseSize > 0 && size > p.cfg.MaxResponseSize {
+		p.log.Error("worker response is too large", zap.String("request_id", requestID(ctx)), zap.Int("size", size), zap.Int("limit", p.cfg.MaxResponseSize))
+		return newStatusError(http.StatusBadGateway, "response is too large")
+	}
+
+	return nil
+}
+
+// noBody reports whether the responses with the status must not have a body
+func noBody(status int) bool {
+	return status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified
+}
+
+// contentEncoded reports whether the Content-Encoding header value means the worker encoded (compressed) the body itself
+func contentEncoded(encoding string) bool {
+	encoding = strings.TrimSpace(encoding)
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// unavailableResponse is returned when there are no free workers to handle the request
+func unavailableResponse() events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusServiceUnavailable,
+		Headers:    map[string]string{"Retry-After": retryAfter},
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCookiesKeepTheAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		cookies []string
+		want    []string
+	}{
+		{
+			name:    "attributes",
+			headers: map[string]string{"Set-Cookie": "sid=abc; Path=/; Secure; HttpOnly; SameSite=Lax"},
+			want:    []string{"sid=abc; Path=/; Secure; HttpOnly; SameSite=Lax"},
+		},
+		{
+			name:    "multiple",
+			headers: map[string]string{"set-cookie": "sid=abc; Path=/; Secure; HttpOnly; SameSite=Lax\nlang=en; Expires=Wed, 21 Oct 2037 07:28:00 GMT"},
+			want:    []string{"sid=abc; Path=/; Secure; HttpOnly; SameSite=Lax", "lang=en; Expires=Wed, 21 Oct 2037 07:28:00 GMT"},
+		},
+		{
+			name:    "worker cookies",
+			headers: map[string]string{"Set-Cookie": "b=2; Max-Age=0"},
+			cookies: []string{"a=1; Domain=example.com"},
+			want:    []string{"a=1; Domain=example.com", "b=2; Max-Age=0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: tt.headers, Cookies: tt.cookies}, nil))
+
+			rsp := serve(t, p, testRequest("/login"))
+			assert.Equal(t, tt.want, rsp.Cookies)
+			assert.Empty(t, getHeader(rsp.Headers, "set-cookie"))
+		})
+	}
+}
+
+func TestStatusReasonIsLoggedAndConsumed(t *testing.T) {
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusUnprocessableEntity,
+		Headers:    map[string]string{"x-status-reason": "email already taken", "Content-Type": "application/json"},
+		Body:       `{"error":"email"}`,
+	}, nil))
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, http.StatusUnprocessableEntity, rsp.StatusCode)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, rsp.Headers)
+
+	entries := logs.FilterMessage("worker status reason").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "email already taken", fields["reason"])
+	assert.Equal(t, int64(http.StatusUnprocessableEntity), fields["status"])
+	assert.Equal(t, testRequestID, fields["request_id"])
+}
+
+func TestDefaultContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultType string
+		headers     map[string]string
+		body        string
+		want        string
+	}{
+		{name: "applied", defaultType: "text/html; charset=utf-8", body: "<p>hi</p>", want: "text/html; charset=utf-8"},
+		{name: "unset", body: "<p>hi</p>"},
+		{name: "worker content type", defaultType: "text/html", headers: map[string]string{"content-type": "text/plain"}, body: "hi", want: "text/plain"},
+		{name: "empty body", defaultType: "text/html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{DefaultContentType: tt.defaultType}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Headers: tt.headers, Body: tt.body}, nil))
+
+			rsp := serve(t, p, testRequest("/"))
+			assert.Equal(t, tt.want, rsp.Headers["Content-Type"])
+		})
+	}
+}
+
+func TestRedirectLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		want     string
+		warn     bool
+	}{
+		{name: "relative", location: "/new-path", want: "/new-path"},
+		{name: "absolute", location: "https://example.com/new-path?a=1", want: "https://example.com/new-path?a=1"},
+		{name: "multiple", location: "/first\n/second", want: "/first", warn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			logs := newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{
+				StatusCode: http.StatusFound,
+				Headers:    map[string]string{"location": tt.location},
+			}, nil))
+
+			rsp := serve(t, p, testRequest("/old-path"))
+			assert.Equal(t, http.StatusFound, rsp.StatusCode)
+			assert.Equal(t, map[string]string{"Location": tt.want}, rsp.Headers)
+			assert.Equal(t, tt.warn, logs.FilterMessage("multiple Location values, the first one is used").Len() == 1)
+		})
+	}
+}
+
+func TestMissingWorkerStatus(t *testing.T) {
+	for _, status := range []int{0, -1} {
+		p := &Plugin{}
+		logs := newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: status, Body: "ok"}, nil))
+
+		rsp := serve(t, p, testRequest("/"))
+		assert.Equal(t, http.StatusOK, rsp.StatusCode, status)
+		assert.Equal(t, "ok", rsp.Body)
+
+		entries := logs.FilterMessage("worker response has no status code, 200 is used").All()
+		require.Len(t, entries, 1, status)
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	}
+
+	// the worker status is kept
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusAccepted}, nil))
+	assert.Equal(t, http.StatusAccepted, serve(t, p, testRequest("/")).StatusCode)
+	assert.Zero(t, logs.FilterMessage("worker response has no status code, 200 is used").Len())
+}
+
+func TestConfiguredResponseHeaders(t *testing.T) {
+	cfgHeaders := map[string]string{"x-content-type-options": "nosniff", "strict-transport-security": "max-age=31536000"}
+
+	tests := []struct {
+		name     string
+		override bool
+		want     map[string]string
+	}{
+		{
+			name: "worker precedence",
+			want: map[string]string{"Content-Type": "text/plain", "X-Content-Type-Options": "worker", "Strict-Transport-Security": "max-age=31536000"},
+		},
+		{
+			name:     "config precedence",
+			override: true,
+			want:     map[string]string{"Content-Type": "text/plain", "X-Content-Type-Options": "nosniff", "Strict-Transport-Security": "max-age=31536000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{ResponseHeaders: cfgHeaders, ResponseHeadersOverride: tt.override}, respond(events.APIGatewayV2HTTPResponse{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"content-type": "text/plain", "x-content-type-options": "worker"},
+				Body:       "ok",
+			}, nil))
+
+			rsp := serve(t, p, testRequest("/"))
+			assert.Equal(t, tt.want, rsp.Headers)
+		})
+	}
+}
+
+// shortCircuit responds to every request without calling the worker
+type shortCircuit struct{}
+
+func (*shortCircuit) InterceptRequest(context.Context, *events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	return &events.APIGatewayV2HTTPResponse{StatusCode: http.StatusTeapot, Headers: map[string]string{"x-content-type-options": "interceptor"}}, nil
+}
+
+func TestConfiguredResponseHeadersOnEveryResponse(t *testing.T) {
+	cfgHeaders := map[string]string{"x-content-type-options": "nosniff"}
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		fn      execFunc
+		plugins []any
+		path    string
+		status  int
+		want    string
+	}{
+		{
+			name: "worker error",
+			cfg:  &Config{},
+			fn: func(context.Context, *payload.Payload) (*payload.Payload, error) {
+				return nil, errors.Str("worker failed")
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "rejected request",
+			cfg:    &Config{MaxBodySize: 1},
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "health check",
+			cfg:    &Config{HealthPath: "/health"},
+			path:   "/health",
+			status: http.StatusOK,
+		},
+		{
+			name:    "interceptor response",
+			cfg:     &Config{},
+			plugins: []any{&shortCircuit{}},
+			status:  http.StatusTeapot,
+			// the interceptor header in another case is not duplicated
+			want: "interceptor",
+		},
+		{
+			name:   "response too large",
+			cfg:    &Config{MaxResponseSize: 10},
+			status: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := tt.fn
+			if fn == nil {
+				fn = respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Body: "a large enough body"}, nil)
+			}
+
+			tt.cfg.ResponseHeaders = cfgHeaders
+			p := &Plugin{}
+			newTestPlugin(t, p, tt.cfg, fn, tt.plugins...)
+
+			path := tt.path
+			if path == "" {
+				path = "/users"
+			}
+
+			request := testRequest(path)
+			request.Body = "body"
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+
+			want := tt.want
+			if want == "" {
+				want = "nosniff"
+			}
+			assert.Equal(t, want, rsp.Headers["X-Content-Type-Options"])
+			assert.NotContains(t, rsp.Headers, "x-content-type-options")
+		})
+	}
+}
+
+func TestConfiguredResponseHeadersOn503(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{MaxConcurrency: 1, ResponseHeaders: map[string]string{"x-content-type-options": "nosniff"}}, respond(events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK}, nil))
+
+	require.True(t, p.acquire())
+	defer p.release()
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+	assert.Equal(t, map[string]string{"Retry-After": retryAfter, "X-Content-Type-Options": "nosniff"}, rsp.Headers)
+}
+
+func TestNoBodyStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		response   events.APIGatewayV2HTTPResponse
+		wantBody   string
+		wantLength string
+	}{
+		{
+			name:     "204",
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 204, Headers: map[string]string{"Content-Length": "5"}, Body: "stale"},
+		},
+		{
+			name:     "304",
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 304, Headers: map[string]string{"content-length": "5"}, Body: "c3RhbGU=", IsBase64Encoded: true},
+		},
+		{
+			name:     "1xx",
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 103, Body: "early"},
+		},
+		{
+			name:     "empty body with a stale length",
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: map[string]string{"Content-Length": "10"}},
+		},
+		{
+			name:       "empty body with zero length",
+			response:   events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: map[string]string{"Content-Length": "0"}},
+			wantLength: "0",
+		},
+		{
+			name:       "head keeps the get length",
+			method:     http.MethodHead,
+			response:   events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: map[string]string{"Content-Length": "10"}},
+			wantLength: "10",
+		},
+		{
+			name:       "200",
+			response:   events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: map[string]string{"Content-Length": "2"}, Body: "ok"},
+			wantBody:   "ok",
+			wantLength: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{}, respond(tt.response, nil))
+
+			request := testRequest("/users")
+			if tt.method != "" {
+				request.RequestContext.HTTP.Method = tt.method
+			}
+
+			rsp := serve(t, p, request)
+			assert.Equal(t, tt.response.StatusCode, rsp.StatusCode)
+			assert.Equal(t, tt.wantBody, rsp.Body)
+			assert.False(t, rsp.IsBase64Encoded)
+			assert.Equal(t, tt.wantLength, getHeader(rsp.Headers, "content-length"))
+		})
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	body := strings.Repeat("a", 1000)
+
+	tests := []struct {
+		name           string
+		maxSize        int
+		maxHeaderBytes int
+		response       events.APIGatewayV2HTTPResponse
+		status         int
+		msg            string
+		log            string
+	}{
+		{name: "default limit", response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: body}, status: 200},
+		{name: "within the limit", maxSize: 2000, response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: body}, status: 200},
+		{
+			name:     "over the limit",
+			maxSize:  500,
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: body},
+			status:   http.StatusBadGateway,
+			msg:      "response is too large",
+			log:      "worker response is too large",
+		},
+		{
+			name:     "headers count toward the size",
+			maxSize:  1010,
+			response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Headers: map[string]string{"X-Trace": "0123456789"}, Body: body},
+			status:   http.StatusBadGateway,
+			msg:      "response is too large",
+			log:      "worker response is too large",
+		},
+		{name: "unlimited", maxSize: -1, response: events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: strings.Repeat("a", 7<<20)}, status: 200},
+		{
+			name:           "headers over the limit",
+			maxHeaderBytes: 20,
+			response:       events.APIGatewayV2HTTPResponse{StatusCode: 200, Cookies: []string{"session=" + strings.Repeat("x", 32)}, Body: "ok"},
+			status:         http.StatusBadGateway,
+			msg:            "response headers are too large",
+			log:            "worker response headers are too large",
+		},
+		{
+			name:           "headers within the limit",
+			maxHeaderBytes: 100,
+			response:       events.APIGatewayV2HTTPResponse{StatusCode: 200, Cookies: []string{"a=1"}, Body: body},
+			status:         200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plugin{}
+			logs := newTestPlugin(t, p, &Config{
+				MaxResponseSize:        tt.maxSize,
+				MaxResponseHeaderBytes: tt.maxHeaderBytes,
+			}, respond(tt.response, nil))
+
+			rsp := serve(t, p, testRequest("/report"))
+			assert.Equal(t, tt.status, rsp.StatusCode)
+			if tt.status == 200 {
+				assert.Equal(t, tt.response.Body, rsp.Body)
+				return
+			}
+
+			assert.Equal(t, tt.msg, rsp.Body)
+			entries := logs.FilterMessage(tt.log).All()
+			require.Len(t, entries, 1)
+			assert.Equal(t, testRequestID, entries[0].ContextMap()["request_id"])
+		})
+	}
+}
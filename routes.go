@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Route maps the requests path prefix to the dedicated worker pool
+type Route struct {
+	// Prefix of the request path, e.g. /api
+	Prefix string `mapstructure:"prefix"`
+	// Command used to start the route workers instead of the server command
+	Command []string `mapstructure:"command"`
+}
+
+type route struct {
+	prefix string
+	pool   Pool
+}
+
+// sortRoutes orders the routes so that the longest prefix is matched first
+func sortRoutes(routes []*route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+}
+
+// matchPrefix reports whether the path is equal to the prefix or lies under it
+func matchPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// selectPool returns the pool of the longest matching route or the default pool
+func (p *Plugin) selectPool(path string) Pool {
+	for i := 0; i < len(p.routes); i++ {
+		if matchPrefix(path, p.routes[i].prefix) {
+			return p.routes[i].pool
+		}
+	}
+
+	return p.wrkPool
+}
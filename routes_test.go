@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{path: "/api", prefix: "/api", want: true},
+		{path: "/api/users", prefix: "/api", want: true},
+		{path: "/apiv2", prefix: "/api", want: false},
+		{path: "/api/users", prefix: "/api/", want: true},
+		{path: "/ap", prefix: "/api", want: false},
+		{path: "/admin", prefix: "/api", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchPrefix(tt.path, tt.prefix), "%s %s", tt.path, tt.prefix)
+	}
+}
+
+func TestSelectPool(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{
+		Routes: []*Route{
+			{Prefix: "/api", Command: []string{"php", "api.php"}},
+			{Prefix: "/api/admin", Command: []string{"php", "admin.php"}},
+		},
+	}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "/api/users", want: []string{"php", "api.php"}},
+		// the longest prefix wins regardless of the configuration order
+		{path: "/api/admin/users", want: []string{"php", "admin.php"}},
+		{path: "/api/administrators", want: []string{"php", "api.php"}},
+		// the default pool uses the server command
+		{path: "/users", want: nil},
+	}
+
+	for _, tt := range tests {
+		wp := p.selectPool(tt.path)
+		require.IsType(t, &testPool{}, wp)
+		assert.Equal(t, tt.want, wp.(*testPool).cfg.Command, tt.path)
+	}
+
+	assert.Same(t, p.wrkPool, p.selectPool("/"))
+}
+
+func TestRoutesValidation(t *testing.T) {
+	assert.Error(t, (&Config{Routes: []*Route{{Command: []string{"php"}}}}).InitDefaults())
+	assert.Error(t, (&Config{Routes: []*Route{{Prefix: "/api"}}}).InitDefaults())
+	assert.NoError(t, (&Config{Routes: []*Route{{Prefix: "/api", Command: []string{"php"}}}}).InitDefaults())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sentinelState returns the modification time of the sentinel file, zero when it doesn't exist
+func sentinelState(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return fi.ModTime()
+}
+
+// checkSentinel resets the workers pools when the reset_sentinel file was changed (created, touched or removed)
+// since the previous check, e.g. when a layer updated the application code in the warm container
+func (p *Plugin) checkSentinel(ctx context.Context) {
+	if p.cfg.ResetSentinel == "" {
+		return
+	}
+
+	state := sentinelState(p.cfg.ResetSentinel)
+
+	// the exclusive lock is only taken for the reset
+	p.mu.RLock()
+	unchanged := state.Equal(p.sentinel)
+	p.mu.RUnlock()
+
+	if unchanged {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// reset by the concurrent request
+	if state.Equal(p.sentinel) {
+		return
+	}
+
+	p.sentinel = state
+	p.log.Info("reset sentinel changed, resetting the workers", zap.String("sentinel", p.cfg.ResetSentinel), zap.String("request_id", requestID(ctx)))
+
+	if p.wrkPool != nil {
+		err := p.wrkPool.Reset(ctx)
+		if err != nil {
+			p.log.Error("failed to reset the workers", zap.Error(err))
+		}
+	}
+
+	for i := 0; i < len(p.routes); i++ {
+		err := p.routes[i].pool.Reset(ctx)
+		if err != nil {
+			p.log.Error("failed to reset the route workers", zap.String("prefix", p.routes[i].prefix), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetSentinel(t *testing.T) {
+	sentinel := filepath.Join(t.TempDir(), "reset")
+
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{
+		ResetSentinel: sentinel,
+		Routes:        []*Route{{Prefix: "/admin", Command: []string{"php", "admin.php"}}},
+	}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	resets := func() []int {
+		out := make([]int, 0, 2)
+		for _, wp := range []Pool{p.wrkPool, p.routes[0].pool} {
+			tp := wp.(*testPool)
+			tp.mu.Lock()
+			out = append(out, tp.resets)
+			tp.mu.Unlock()
+		}
+
+		return out
+	}
+
+	modified := time.Now().Add(-time.Hour)
+	steps := []struct {
+		name   string
+		change func()
+		want   []int
+	}{
+		{name: "missing", change: func() {}, want: []int{0, 0}},
+		{name: "created", change: func() {
+			require.NoError(t, os.WriteFile(sentinel, nil, 0o600))
+			require.NoError(t, os.Chtimes(sentinel, modified, modified))
+		}, want: []int{1, 1}},
+		{name: "unchanged", change: func() {}, want: []int{1, 1}},
+		{name: "touched", change: func() {
+			require.NoError(t, os.Chtimes(sentinel, time.Now(), time.Now()))
+		}, want: []int{2, 2}},
+		{name: "removed", change: func() {
+			require.NoError(t, os.Remove(sentinel))
+		}, want: []int{3, 3}},
+	}
+
+	for _, step := range steps {
+		step.change()
+
+		rsp := serve(t, p, testRequest("/users"))
+		assert.Equal(t, 200, rsp.StatusCode, step.name)
+		assert.Equal(t, step.want, resets(), step.name)
+	}
+
+	entries := logs.FilterMessage("reset sentinel changed, resetting the workers").All()
+	require.Len(t, entries, 3)
+	assert.Equal(t, testRequestID, entries[0].ContextMap()["request_id"])
+}
+
+func TestResetSentinelDisabled(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+	serve(t, p, testRequest("/users"))
+	assert.Zero(t, p.wrkPool.(*testPool).resets)
+}
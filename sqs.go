@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	attrMessageID      string = "message_id"
+	attrEventSourceArn string = "event_source_arn"
+
+	// idempotency keys
+	idempotencyMessageID       string = "message_id"
+	idempotencyDeduplicationID string = "deduplication_id"
+)
+
+// asyncResult is the part of the worker response meaningful for the async event sources
+type asyncResult struct {
+	StatusCode int `json:"statusCode"`
+}
+
+// sqsHandler handles the SQS events, the worker is invoked once per message. The message is acknowledged
+// when the worker response status is below 400. Failed messages are reported as the batch item failures
+// when batch_item_failures is on, otherwise the error is returned to make lambda retry the whole batch
+func (p *Plugin) sqsHandler() func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	return func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+		const op = errors.Op("lambda_sqs_handler")
+
+		var response events.SQSEventResponse
+
+		if !p.acquire() {
+			return response, errors.E(op, errors.NoFreeWorkers, errors.Str("max concurrency reached"))
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+
+		for i := 0; i < len(event.Records); i++ {
+			msg := &event.Records[i]
+
+			key := p.idempotencyKey(msg)
+			if key != "" && p.idempotency.seen(key) {
+				p.log.Debug("duplicate message, skipping", zap.String("request_id", requestID(ctx)), zap.String("message_id", msg.MessageId), zap.String("key", key))
+				continue
+			}
+
+			attrs[attrRequestID] = requestID(ctx)
+			attrs[attrMessageID] = msg.MessageId
+			attrs[attrEventSourceArn] = msg.EventSourceARN
+
+			var result asyncResult
+			err := p.invoke(ctx, p.wrkPool, msg, attrs, &result)
+			if err == nil && result.StatusCode >= http.StatusBadRequest {
+				err = errors.Errorf("worker responded with status %d", result.StatusCode)
+			}
+
+			if err != nil {
+				if !p.cfg.BatchItemFailures {
+					return response, errors.E(op, err)
+				}
+
+				p.log.Warn("message processing failed", zap.String("request_id", requestID(ctx)), zap.String("message_id", msg.MessageId), zap.Error(err))
+				response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: msg.MessageId})
+				continue
+			}
+
+			if key != "" {
+				p.idempotency.add(key)
+			}
+		}
+
+		return response, nil
+	}
+}
+
+// idempotencyKey returns the message deduplication key, empty when the deduplication is disabled or the key is absent
+func (p *Plugin) idempotencyKey(msg *events.SQSMessage) string {
+	if p.idempotency == nil {
+		return ""
+	}
+
+	switch p.cfg.Idempotency.Key {
+	case idempotencyMessageID:
+		return msg.MessageId
+	case idempotencyDeduplicationID:
+		return msg.Attributes["MessageDeduplicationId"]
+	default:
+		// message attribute
+		attr, ok := msg.MessageAttributes[p.cfg.Idempotency.Key]
+		if !ok || attr.StringValue == nil {
+			return ""
+		}
+
+		return *attr.StringValue
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqsWorker responds with the status and stores the processed message ids
+func sqsWorker(t testing.TB, status func(msg *events.SQSMessage) int, processed *[]string) execFunc {
+	return func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+		var msg events.SQSMessage
+		require.NoError(t, json.Unmarshal(pld.Body, &msg))
+		*processed = append(*processed, msg.MessageId)
+
+		body, err := json.Marshal(asyncResult{StatusCode: status(&msg)})
+		if err != nil {
+			return nil, err
+		}
+
+		return &payload.Payload{Body: body}, nil
+	}
+}
+
+func ok(*events.SQSMessage) int {
+	return 200
+}
+
+func stringAttr(v string) events.SQSMessageAttribute {
+	return events.SQSMessageAttribute{StringValue: &v, DataType: "String"}
+}
+
+func TestSQSIdempotency(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		messages []events.SQSMessage
+		want     []string
+	}{
+		{
+			name:     "message id",
+			key:      idempotencyMessageID,
+			messages: []events.SQSMessage{{MessageId: "1"}, {MessageId: "1"}, {MessageId: "2"}},
+			want:     []string{"1", "2"},
+		},
+		{
+			name: "deduplication id",
+			key:  idempotencyDeduplicationID,
+			messages: []events.SQSMessage{
+				{MessageId: "1", Attributes: map[string]string{"MessageDeduplicationId": "order-1"}},
+				{MessageId: "2", Attributes: map[string]string{"MessageDeduplicationId": "order-1"}},
+				// no key, never deduplicated
+				{MessageId: "3"},
+				{MessageId: "4"},
+			},
+			want: []string{"1", "3", "4"},
+		},
+		{
+			name: "message attribute",
+			key:  "idempotency_key",
+			messages: []events.SQSMessage{
+				{MessageId: "1", MessageAttributes: map[string]events.SQSMessageAttribute{"idempotency_key": stringAttr("a")}},
+				{MessageId: "2", MessageAttributes: map[string]events.SQSMessageAttribute{"idempotency_key": stringAttr("a")}},
+				{MessageId: "3", MessageAttributes: map[string]events.SQSMessageAttribute{"idempotency_key": stringAttr("b")}},
+			},
+			want: []string{"1", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var processed []string
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{EventType: eventTypeSQS, Idempotency: IdempotencyConfig{Key: tt.key, TTL: time.Minute}}, sqsWorker(t, ok, &processed))
+
+			rsp, err := p.sqsHandler()(testContext(), events.SQSEvent{Records: tt.messages})
+			require.NoError(t, err)
+			assert.Empty(t, rsp.BatchItemFailures)
+			assert.Equal(t, tt.want, processed)
+
+			// the redelivered batch is acknowledged without the worker
+			processed = nil
+			_, err = p.sqsHandler()(testContext(), events.SQSEvent{Records: tt.messages[:1]})
+			require.NoError(t, err)
+			assert.Empty(t, processed)
+		})
+	}
+}
+
+func TestSQSIdempotencyFailedMessagesRetried(t *testing.T) {
+	var processed []string
+	status := 500
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeSQS, BatchItemFailures: true, Idempotency: IdempotencyConfig{TTL: time.Minute}}, sqsWorker(t, func(*events.SQSMessage) int {
+		return status
+	}, &processed))
+
+	event := events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1"}}}
+
+	rsp, err := p.sqsHandler()(testContext(), event)
+	require.NoError(t, err)
+	assert.Len(t, rsp.BatchItemFailures, 1)
+
+	// the failed message is not remembered, the retry reaches the worker
+	status = 200
+	rsp, err = p.sqsHandler()(testContext(), event)
+	require.NoError(t, err)
+	assert.Empty(t, rsp.BatchItemFailures)
+	assert.Equal(t, []string{"1", "1"}, processed)
+}
+
+func TestSQSIdempotencyDisabled(t *testing.T) {
+	var processed []string
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeSQS}, sqsWorker(t, ok, &processed))
+
+	_, err := p.sqsHandler()(testContext(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1"}, {MessageId: "1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "1"}, processed)
+}
+
+func TestIdempotencyTTL(t *testing.T) {
+	i := newIdempotency(time.Millisecond * 20)
+
+	assert.False(t, i.seen("a"))
+	i.add("a")
+	assert.True(t, i.seen("a"))
+
+	time.Sleep(time.Millisecond * 30)
+	assert.False(t, i.seen("a"))
+
+	// the expired keys are swept on add
+	i.add("b")
+	assert.NotContains(t, i.keys, "a")
+	assert.True(t, i.seen("b"))
+}
+
+func TestSQSBatchItemFailures(t *testing.T) {
+	statuses := map[string]int{"1": 200, "2": 500, "3": 399, "4": 404}
+
+	var processed []string
+	p := &Plugin{}
+	logs := newTestPlugin(t, p, &Config{EventType: eventTypeSQS, BatchItemFailures: true}, sqsWorker(t, func(msg *events.SQSMessage) int {
+		return statuses[msg.MessageId]
+	}, &processed))
+
+	rsp, err := p.sqsHandler()(testContext(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1"}, {MessageId: "2"}, {MessageId: "3"}, {MessageId: "4"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "2"}, {ItemIdentifier: "4"}}, rsp.BatchItemFailures)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, processed)
+	assert.Equal(t, 2, logs.FilterMessage("message processing failed").Len())
+}
+
+func TestSQSFailureRetriesTheBatch(t *testing.T) {
+	var processed []string
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeSQS}, sqsWorker(t, func(msg *events.SQSMessage) int {
+		if msg.MessageId == "2" {
+			return 500
+		}
+
+		return 200
+	}, &processed))
+
+	_, err := p.sqsHandler()(testContext(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1"}, {MessageId: "2"}, {MessageId: "3"}}})
+	assert.ErrorContains(t, err, "worker responded with status 500")
+	assert.Equal(t, []string{"1", "2"}, processed)
+}
+
+func TestSQSWorkerBodyIgnored(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeSQS, BatchItemFailures: true}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		// no http response, only the status matters
+		return &payload.Payload{Body: []byte(`{"statusCode":202,"headers":null,"body":"ignored"}`)}, nil
+	})
+
+	rsp, err := p.sqsHandler()(testContext(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1"}}})
+	require.NoError(t, err)
+	assert.Empty(t, rsp.BatchItemFailures)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// statusError rejects the request with the provided HTTP status, the message is sent to the client
+type statusError struct {
+	status int
+	msg    string
+}
+
+func newStatusError(status int, msg string) error {
+	return &statusError{status: status, msg: msg}
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// errorResponse converts the error into the response, errors other than statusError are 500 without a body
+func errorResponse(err error) events.APIGatewayV2HTTPResponse {
+	var se *statusError
+	if errors.As(err, &se) {
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: se.status,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       se.msg,
+		}
+	}
+
+	return events.APIGatewayV2HTTPResponse{Body: "", StatusCode: http.StatusInternalServerError}
+}
+
+// workerStatus returns the worker response status, 200 when the worker didn't set a valid one
+func (p *Plugin) workerStatus(ctx context.Context, status int) int {
+	if status > 0 {
+		return status
+	}
+
+	p.log.Warn("worker response has no status code, 200 is used", zap.String("request_id", requestID(ctx)), zap.Int("status", status))
+
+	return http.StatusOK
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceparentHeader is the W3C trace context header, https://www.w3.org/TR/trace-context/
+const traceparentHeader string = "traceparent"
+
+// setTraceparent adds the traceparent header when the client didn't send one, so the worker can start the root span.
+// The trace id is the lambda request id (a UUID), a random one is used when the request id is not a UUID
+func setTraceparent(ctx context.Context, headers map[string]string) {
+	if getHeader(headers, traceparentHeader) != "" {
+		return
+	}
+
+	var parentID [8]byte
+	_, _ = rand.Read(parentID[:])
+
+	traceID := strings.ReplaceAll(requestID(ctx), "-", "")
+	if !validTraceID(traceID) {
+		var id [16]byte
+		_, _ = rand.Read(id[:])
+		traceID = hex.EncodeToString(id[:])
+	}
+
+	headers[traceparentHeader] = "00-" + traceID + "-" + hex.EncodeToString(parentID[:]) + "-01"
+}
+
+// validTraceID reports whether the id is 32 lowercase hex digits and not all zeros
+func validTraceID(id string) bool {
+	if len(id) != 32 || id == strings.Repeat("0", 32) {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if !(id[i] >= '0' && id[i] <= '9' || id[i] >= 'a' && id[i] <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newTracerProvider creates the tracer provider exporting the spans with the otel.exporter, unless the span processor
+// is provided. The spans are exported synchronously, lambda may freeze the container right after the response
+func newTracerProvider(cfg *OtelConfig, sp sdktrace.SpanProcessor) (*sdktrace.TracerProvider, error) {
+	if sp == nil {
+		w := os.Stdout
+		if cfg.Exporter == otelExporterStderr {
+			w = os.Stderr
+		}
+
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, err
+		}
+
+		sp = sdktrace.NewSimpleSpanProcessor(exp)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.CloudProviderAWS,
+		semconv.CloudPlatformAWSLambda,
+	)
+
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sp), sdktrace.WithResource(res)), nil
+}
+
+// startSpan starts the invocation span with the plugin tracer provider.
+// The parent is extracted from the request trace context headers, the span context is propagated to the worker the same way
+func (p *Plugin) startSpan(ctx context.Context, request *events.APIGatewayV2HTTPRequest) (context.Context, trace.Span) {
+	prop := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	carrier := propagation.MapCarrier(request.Headers)
+
+	ctx, span := p.tracerProvider.Tracer(pluginName).Start(prop.Extract(ctx, carrier), request.RouteKey,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", request.RequestContext.HTTP.Method),
+			attribute.String("http.route", request.RouteKey),
+			attribute.String("url.path", request.RawPath),
+			attribute.String("faas.invocation_id", requestID(ctx)),
+		),
+	)
+
+	prop.Inject(ctx, carrier)
+
+	return ctx, span
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var traceparentRe = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-01$`)
+
+func TestTraceparentPassThrough(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+	request := testRequest("/users")
+	request.Headers["traceparent"] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	request.Headers["tracestate"] = "congo=t61rcWkgMzE"
+
+	serve(t, p, request)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", requests[0].Headers["traceparent"])
+	assert.Equal(t, "congo=t61rcWkgMzE", requests[0].Headers["tracestate"])
+}
+
+func TestTraceparentGenerated(t *testing.T) {
+	var requests []events.APIGatewayV2HTTPRequest
+
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, &requests))
+
+	serve(t, p, testRequest("/users"))
+	require.Len(t, requests, 1)
+
+	// seeded from the lambda request id
+	m := traceparentRe.FindStringSubmatch(requests[0].Headers["traceparent"])
+	require.NotNil(t, m, requests[0].Headers["traceparent"])
+	assert.Equal(t, strings.ReplaceAll(testRequestID, "-", ""), m[1])
+	assert.Empty(t, requests[0].Headers["tracestate"])
+}
+
+func TestTraceparentRandomTraceID(t *testing.T) {
+	for _, id := range []string{"", "not-a-uuid", "00000000-0000-0000-0000-000000000000"} {
+		headers := map[string]string{}
+		setTraceparent(lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: id}), headers)
+
+		m := traceparentRe.FindStringSubmatch(headers["traceparent"])
+		require.NotNil(t, m, id)
+		assert.True(t, validTraceID(m[1]), id)
+	}
+}
+
+func TestValidTraceID(t *testing.T) {
+	tests := map[string]bool{
+		"4bf92f3577b34da6a3ce929d0e0e4736":  true,
+		"4BF92F3577B34DA6A3CE929D0E0E4736":  false,
+		"00000000000000000000000000000000":  false,
+		"4bf92f3577b34da6a3ce929d0e0e473":   false,
+		"4bf92f3577b34da6a3ce929d0e0e47366": false,
+		"4bf92f3577b34da6a3ce929d0e0e473g":  false,
+	}
+
+	for id, want := range tests {
+		assert.Equal(t, want, validTraceID(id), id)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// build information, set at build time:
+// go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+//nolint:gochecknoglobals // set via -ldflags
+var (
+	version   = "local"
+	commit    = "none"
+	buildTime = "unknown"
+)
+
+// poweredBy is the X-Powered-By response header value
+func poweredBy() string {
+	return "roadrunner-lambda/" + version
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoweredBy(t *testing.T) {
+	assert.NotEmpty(t, version)
+	assert.Equal(t, "roadrunner-lambda/"+version, poweredBy())
+
+	for _, enabled := range []bool{true, false} {
+		p := &Plugin{}
+		newTestPlugin(t, p, &Config{PoweredBy: enabled}, respond(events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil))
+
+		rsp := serve(t, p, testRequest("/users"))
+		if enabled {
+			assert.Equal(t, poweredBy(), rsp.Headers["X-Powered-By"])
+		} else {
+			assert.NotContains(t, rsp.Headers, "X-Powered-By")
+		}
+	}
+}
+
+func TestPoweredByKeepsTheWorkerHeader(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{PoweredBy: true}, respond(events.APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"x-powered-by": "php"},
+	}, nil))
+
+	rsp := serve(t, p, testRequest("/users"))
+	assert.Equal(t, "php", rsp.Headers["X-Powered-By"])
+}
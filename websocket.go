@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roadrunner-server/errors"
+)
+
+const (
+	attrRouteKey     string = "route_key"
+	attrConnectionID string = "connection_id"
+	attrEventType    string = "event_type"
+	attrDomainName   string = "domain_name"
+)
+
+// websocketHandler handles the API Gateway WebSocket API events ($connect, $disconnect, $default and custom routes).
+// The route key and connection id are sent as attributes, the worker responds with the proxy response,
+// a non-2xx status for the $connect route rejects the connection
+func (p *Plugin) websocketHandler() func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if !p.acquire() {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusServiceUnavailable}, nil
+		}
+		defer p.release()
+
+		attrs := p.getAttrs()
+		defer p.putAttrs(attrs)
+		attrs[attrRequestID] = requestID(ctx)
+		attrs[attrRouteKey] = request.RequestContext.RouteKey
+		attrs[attrConnectionID] = request.RequestContext.ConnectionID
+		attrs[attrEventType] = request.RequestContext.EventType
+		attrs[attrDomainName] = request.RequestContext.DomainName
+		attrs[attrStage] = request.RequestContext.Stage
+
+		var response events.APIGatewayProxyResponse
+		err := p.invoke(ctx, p.wrkPool, request, attrs, &response)
+		if err != nil {
+			if errors.Is(errors.NoFreeWorkers, err) || errors.Is(errors.QueueSize, err) {
+				return events.APIGatewayProxyResponse{StatusCode: http.StatusServiceUnavailable}, nil
+			}
+
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, nil
+		}
+
+		return response, nil
+	}
+}
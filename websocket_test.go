@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/goccy/go-json"
+	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebsocketRouting(t *testing.T) {
+	tests := []struct {
+		routeKey  string
+		eventType string
+		body      string
+		auth      string
+		status    int
+	}{
+		{routeKey: "$connect", eventType: "CONNECT", auth: "secret", status: http.StatusOK},
+		// the non-2xx status rejects the connection
+		{routeKey: "$connect", eventType: "CONNECT", status: http.StatusForbidden},
+		{routeKey: "$disconnect", eventType: "DISCONNECT", status: http.StatusOK},
+		{routeKey: "$default", eventType: "MESSAGE", body: `{"action":"ping"}`, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.routeKey, func(t *testing.T) {
+			var attrs map[string]string
+			var received events.APIGatewayWebsocketProxyRequest
+
+			p := &Plugin{}
+			newTestPlugin(t, p, &Config{EventType: eventTypeWebsocket}, func(_ context.Context, pld *payload.Payload) (*payload.Payload, error) {
+				require.NoError(t, p.decode(pld.Context, &attrs))
+				require.NoError(t, json.Unmarshal(pld.Body, &received))
+
+				response := events.APIGatewayProxyResponse{StatusCode: http.StatusOK}
+				switch attrs[attrRouteKey] {
+				case "$connect":
+					if received.Headers["Authorization"] != "secret" {
+						response.StatusCode = http.StatusForbidden
+					}
+				case "$default":
+					response.Body = `{"action":"pong"}`
+				}
+
+				body, err := json.Marshal(response)
+				if err != nil {
+					return nil, err
+				}
+
+				return &payload.Payload{Body: body}, nil
+			})
+
+			request := events.APIGatewayWebsocketProxyRequest{
+				Body:    tt.body,
+				Headers: map[string]string{"Authorization": tt.auth},
+				RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+					RouteKey:     tt.routeKey,
+					EventType:    tt.eventType,
+					ConnectionID: "conn-1",
+					DomainName:   "ws.example.com",
+					Stage:        "prod",
+				},
+			}
+
+			rsp, err := p.websocketHandler()(testContext(), request)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, rsp.StatusCode)
+
+			assert.Equal(t, tt.routeKey, attrs[attrRouteKey])
+			assert.Equal(t, tt.eventType, attrs[attrEventType])
+			assert.Equal(t, "conn-1", attrs[attrConnectionID])
+			assert.Equal(t, "ws.example.com", attrs[attrDomainName])
+			assert.Equal(t, "prod", attrs[attrStage])
+			assert.Equal(t, tt.body, received.Body)
+
+			if tt.routeKey == "$default" {
+				assert.Equal(t, `{"action":"pong"}`, rsp.Body)
+			}
+		})
+	}
+}
+
+func TestWebsocketWorkerError(t *testing.T) {
+	p := &Plugin{}
+	newTestPlugin(t, p, &Config{EventType: eventTypeWebsocket}, func(context.Context, *payload.Payload) (*payload.Payload, error) {
+		return nil, errors.Str("worker failed")
+	})
+
+	rsp, err := p.websocketHandler()(testContext(), events.APIGatewayWebsocketProxyRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, rsp.StatusCode)
+}